@@ -0,0 +1,70 @@
+package bolt
+
+import (
+	"bytes"
+
+	"github.com/encryptio/kvl"
+	"github.com/boltdb/bolt"
+)
+
+// appendFillPercent is the bucket FillPercent used for batches that only add
+// keys after the last one in the DB. Since nothing will be inserted into the
+// pages they fill, there is no reason to leave room in them.
+const appendFillPercent = 1.0
+
+// BulkLoad writes each batch with a single bolt transaction, putting its keys
+// in ascending order. When a batch is appended after the existing keys, as
+// every batch is if the pairs are loaded in order, its pages are filled
+// completely instead of half.
+func (db *db) BulkLoad(src kvl.PairSource, opts *kvl.BulkOptions) (kvl.BulkStats, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return kvl.BulkStats{}, err
+	}
+	defer db.gate.Leave()
+
+	failIfExists := opts != nil && opts.FailIfExists
+	return kvl.BulkBatches(src, opts, func(batch []kvl.Pair) error {
+		db.commitMu.Lock()
+		defer db.commitMu.Unlock()
+
+		written := make([]string, 0, len(batch))
+		var version uint64
+		err := db.b.Update(func(btx *bolt.Tx) error {
+			b, err := btx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+
+			last, _ := b.Cursor().Last()
+			if last == nil || bytes.Compare(batch[0].Key, last) > 0 {
+				b.FillPercent = appendFillPercent
+			}
+
+			for _, p := range batch {
+				_, err := db.limits.Add(kvl.TxSize{}, p.Key, p.Value)
+				if err != nil {
+					return err
+				}
+				if failIfExists && b.Get(p.Key) != nil {
+					return &kvl.KeyExistsError{Key: p.Key}
+				}
+
+				err = b.Put(p.Key, p.Value)
+				if err != nil {
+					return err
+				}
+				written = append(written, string(p.Key))
+			}
+
+			version = uint64(btx.ID())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		db.watches.Trigger(written, version)
+		return nil
+	})
+}
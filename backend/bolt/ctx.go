@@ -4,12 +4,26 @@ import (
 	"bytes"
 
 	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/watch"
 	"github.com/boltdb/bolt"
 )
 
 type ctx struct {
 	bucket   *bolt.Bucket // if nil, assume empty db. Only possible if readonly is true.
 	readonly bool
+	reads    *watch.ReadSet // if non-nil, reads are recorded for a watch
+	written  []string
+	info     kvl.TxInfo
+	limits   kvl.Limits
+	size     kvl.TxSize
+}
+
+func (ctx *ctx) TxInfo() kvl.TxInfo {
+	return ctx.info
+}
+
+func (ctx *ctx) TxSize() kvl.TxSize {
+	return ctx.size
 }
 
 func dupBytes(s []byte) []byte {
@@ -18,7 +32,11 @@ func dupBytes(s []byte) []byte {
 	return n
 }
 
-func (ctx ctx) Get(key []byte) (kvl.Pair, error) {
+func (ctx *ctx) Get(key []byte) (kvl.Pair, error) {
+	if ctx.reads != nil {
+		ctx.reads.AddKey(string(key))
+	}
+
 	if ctx.bucket == nil {
 		return kvl.Pair{}, kvl.ErrNotFound
 	}
@@ -28,10 +46,20 @@ func (ctx ctx) Get(key []byte) (kvl.Pair, error) {
 		return kvl.Pair{}, kvl.ErrNotFound
 	}
 
-	return kvl.Pair{dupBytes(key), val}, nil
+	// val points into bolt's memory map, which is only valid until the
+	// transaction ends
+	return kvl.Pair{dupBytes(key), dupBytes(val)}, nil
 }
 
-func (ctx ctx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
+func (ctx *ctx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
+	ret, err := ctx.rangeBucket(query)
+	if err == nil && ctx.reads != nil {
+		ctx.reads.AddRange(query, ret)
+	}
+	return ret, err
+}
+
+func (ctx *ctx) rangeBucket(query kvl.RangeQuery) ([]kvl.Pair, error) {
 	if ctx.bucket == nil {
 		return nil, nil
 	}
@@ -77,23 +105,45 @@ func (ctx ctx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
 	return ret, nil
 }
 
-func (ctx ctx) Set(p kvl.Pair) error {
+func (ctx *ctx) Set(p kvl.Pair) error {
 	if ctx.readonly {
 		return kvl.ErrReadOnlyTx
 	}
 
-	return ctx.bucket.Put(p.Key, p.Value)
+	size, err := ctx.limits.Add(ctx.size, p.Key, p.Value)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.bucket.Put(p.Key, p.Value)
+	if err != nil {
+		return err
+	}
+	ctx.size = size
+	ctx.written = append(ctx.written, string(p.Key))
+	return nil
 }
 
-func (ctx ctx) Delete(key []byte) error {
+func (ctx *ctx) Delete(key []byte) error {
 	if ctx.readonly {
 		return kvl.ErrReadOnlyTx
 	}
 
+	size, err := ctx.limits.Add(ctx.size, key, nil)
+	if err != nil {
+		return err
+	}
+
 	data := ctx.bucket.Get(key)
 	if data == nil {
 		return kvl.ErrNotFound
 	}
 
-	return ctx.bucket.Delete(key)
+	err = ctx.bucket.Delete(key)
+	if err != nil {
+		return err
+	}
+	ctx.size = size
+	ctx.written = append(ctx.written, string(key))
+	return nil
 }
@@ -1,53 +1,284 @@
 package bolt
 
 import (
+	"context"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/gate"
+	"github.com/encryptio/kvl/backend/internal/urlopt"
+	"github.com/encryptio/kvl/backend/internal/watch"
 	"github.com/boltdb/bolt"
 )
 
 func init() {
-	kvl.RegisterBackend("bolt", Open)
+	kvl.Register(kvl.Backend{
+		Name:        "bolt",
+		Description: "a single file, opened by one process at a time; DSN is the file path",
+		Open:        Open,
+		OpenURL:     openURL,
+	})
 }
 
 var bucketName = []byte("kvl")
 
 type db struct {
+	nextTxID uint64 // atomic; first for alignment
+
 	b *bolt.DB
+
+	// commitMu is held for writing while a read/write transaction commits and
+	// triggers watches, and for reading while a watched transaction runs and
+	// sets up its watch, so that no commit can slip between the two.
+	commitMu sync.RWMutex
+	watches  *watch.Registry
+	gate     gate.Gate
+	limits   kvl.Limits
+}
+
+// Options configures a bolt DB.
+type Options struct {
+	// Timeout is how long to wait for the lock on the file. Zero waits
+	// forever.
+	Timeout time.Duration
+
+	// NoSync disables the fsync after each commit. A crash may then corrupt
+	// the database.
+	NoSync bool
+
+	// ReadOnly opens the file with a shared lock, so that several processes
+	// may read it at once. RunTx fails.
+	ReadOnly bool
+
+	// Mode is the permissions the file is created with. Zero means 0666.
+	Mode os.FileMode
+
+	// Limits bounds the writes of each transaction.
+	Limits kvl.Limits
 }
 
 func Open(dsn string) (kvl.DB, error) {
-	b, err := bolt.Open(dsn, 0666, nil)
+	return OpenOptions(dsn, nil)
+}
+
+// OpenOptions opens the bolt database in the given file, creating it if
+// needed.
+func OpenOptions(path string, opts *Options) (kvl.DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	mode := opts.Mode
+	if mode == 0 {
+		mode = 0666
+	}
+
+	b, err := bolt.Open(path, mode, &bolt.Options{
+		Timeout:  opts.Timeout,
+		ReadOnly: opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.NoSync = opts.NoSync
+
+	return &db{b: b, watches: watch.NewRegistry(), limits: opts.Limits}, nil
+}
+
+// openURL opens URLs like bolt:///abs/path.bolt or bolt:rel/path.bolt, with
+// the query parameters timeout (a duration), nosync, readonly, mode (in
+// octal) and the limits read by urlopt.Parser.Limits.
+func openURL(u *url.URL) (kvl.DB, error) {
+	var opts Options
+	p := urlopt.New(u)
+	p.Duration("timeout", &opts.Timeout)
+	p.Bool("nosync", &opts.NoSync)
+	p.Bool("readonly", &opts.ReadOnly)
+	p.FileMode("mode", &opts.Mode)
+	p.Limits(&opts.Limits)
+	err := p.Done()
 	if err != nil {
 		return nil, err
 	}
 
-	return db{b: b}, nil
+	return OpenOptions(urlopt.Path(u), &opts)
 }
 
-func (db db) Close() {
+// Close is Shutdown with a timeout of kvl.CloseTimeout.
+func (db *db) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), kvl.CloseTimeout)
+	defer cancel()
+	db.Shutdown(ctx)
+}
+
+// Shutdown closes the DB as described by kvl.ShutdownDB. If ctx is done
+// before the running transactions finish, closing the file waits for them
+// anyway, since bolt does not allow aborting them.
+func (db *db) Shutdown(ctx context.Context) error {
+	err := db.gate.Close()
+	if err != nil {
+		return err
+	}
+	db.watches.Close(kvl.ErrClosed)
+
+	err = db.gate.Wait(ctx)
 	db.b.Close()
+	return err
 }
 
-func (db db) RunTx(tx kvl.Tx) error {
-	return db.b.Update(func(btx *bolt.Tx) error {
+// Ping returns kvl.ErrClosed if the DB is closed, or any error from starting
+// a read transaction.
+func (db *db) Ping() error {
+	if db.gate.Closed() {
+		return kvl.ErrClosed
+	}
+	return db.b.View(func(*bolt.Tx) error { return nil })
+}
+
+// Stats reports the key count and the bytes used by leaf pages (or by the
+// inline bucket of a small database), as counted by bolt, and a bolt.Stats as
+// Backend. Counting takes time proportional to the size of the database.
+func (db *db) Stats() kvl.Stats {
+	stats := kvl.Stats{
+		Transactions: db.gate.Active(),
+		Watches:      db.watches.Len(),
+		Backend:      db.b.Stats(),
+	}
+	err := db.b.View(func(btx *bolt.Tx) error {
+		b := btx.Bucket(bucketName)
+		if b != nil {
+			bs := b.Stats()
+			stats.Keys = int64(bs.KeyN)
+			stats.Bytes = int64(bs.LeafInuse + bs.InlineBucketInuse)
+		}
+		return nil
+	})
+	if err != nil {
+		stats.Keys = -1
+		stats.Bytes = -1
+	}
+	return stats
+}
+
+func (db *db) RunTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	start := time.Now()
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+
+	var written []string
+	var version uint64
+	err = db.b.Update(func(btx *bolt.Tx) error {
 		b, err := btx.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
 		}
 
-		return tx(ctx{bucket: b, readonly: false})
+		c := &ctx{
+			bucket:   b,
+			readonly: false,
+			info:     db.newTxInfo(btx, start),
+			limits:   db.limits,
+		}
+		err = tx(c)
+		written = c.written
+		version = uint64(btx.ID())
+		return err
 	})
+	if err != nil {
+		return err
+	}
+
+	db.watches.Trigger(written, version)
+	return nil
 }
 
-func (db db) RunReadTx(tx kvl.Tx) error {
+func (db *db) RunReadTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	start := time.Now()
 	return db.b.View(func(btx *bolt.Tx) error {
 		// NB: may be nil
 		b := btx.Bucket(bucketName)
 
-		return tx(ctx{bucket: b, readonly: true})
+		return tx(&ctx{bucket: b, readonly: true, info: db.newTxInfo(btx, start)})
 	})
 }
 
-func (db db) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
-	return nil, kvl.ErrWatchUnsupported
+// newTxInfo describes a transaction on btx. Bolt never retries transactions.
+func (db *db) newTxInfo(btx *bolt.Tx, start time.Time) kvl.TxInfo {
+	version := uint64(btx.ID())
+	if btx.Writable() {
+		// a writable transaction's ID is the version it commits
+		version--
+	}
+	return kvl.TxInfo{
+		ID:             atomic.AddUint64(&db.nextTxID, 1),
+		Attempt:        1,
+		ReadOnly:       !btx.Writable(),
+		Start:          start,
+		ReadVersion:    version,
+		HasReadVersion: true,
+	}
+}
+
+// RunSnapshotTx is the same as RunReadTx, since bolt read transactions always
+// see a consistent snapshot and are never retried.
+func (db *db) RunSnapshotTx(tx kvl.Tx) error {
+	return db.RunReadTx(tx)
+}
+
+func (db *db) Capabilities() kvl.Capabilities {
+	return kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+		Snapshot:    true,
+		Durable:     true,
+	}
+}
+
+// WatchTx watches for changes made by RunTx on this DB. Changes made by
+// other processes (or other DBs opened on the same file) are not seen.
+func (db *db) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return nil, err
+	}
+	defer db.gate.Leave()
+
+	start := time.Now()
+	db.commitMu.RLock()
+	defer db.commitMu.RUnlock()
+
+	var reads watch.ReadSet
+	err = db.b.View(func(btx *bolt.Tx) error {
+		b := btx.Bucket(bucketName)
+
+		c := &ctx{
+			bucket:   b,
+			readonly: true,
+			reads:    &watch.ReadSet{},
+			info:     db.newTxInfo(btx, start),
+		}
+		err := tx(c)
+		reads = *c.reads
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.watches.Watch(reads), nil
 }
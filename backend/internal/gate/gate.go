@@ -0,0 +1,92 @@
+// Package gate tracks the transactions running on a DB, so that closing it can
+// reject new ones and wait for the running ones to finish.
+package gate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/encryptio/kvl"
+)
+
+// A Gate counts running operations. The zero value is an open Gate.
+type Gate struct {
+	mu     sync.Mutex
+	closed bool
+	active int
+	idle   chan struct{} // made by Wait, closed when active reaches zero
+}
+
+// Enter starts an operation, or returns kvl.ErrClosed if the Gate is closed.
+// Every successful call must be followed by a call to Leave.
+func (g *Gate) Enter() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return kvl.ErrClosed
+	}
+	g.active++
+	return nil
+}
+
+// Leave ends an operation started by Enter.
+func (g *Gate) Leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.active--
+	if g.active == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// Active returns the number of running operations.
+func (g *Gate) Active() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active
+}
+
+// Closed reports whether Close has been called.
+func (g *Gate) Closed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closed
+}
+
+// Close makes further calls to Enter fail. It returns kvl.ErrClosed if the
+// Gate was already closed.
+func (g *Gate) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return kvl.ErrClosed
+	}
+	g.closed = true
+	return nil
+}
+
+// Wait waits for the running operations to finish, or for ctx to be done,
+// returning ctx.Err() in the latter case.
+func (g *Gate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.active == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,47 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+)
+
+func TestGate(t *testing.T) {
+	var g Gate
+
+	if err := g.Enter(); err != nil {
+		t.Fatalf("Enter on open gate returned %v", err)
+	}
+	if g.Active() != 1 {
+		t.Errorf("Active() = %v, wanted 1", g.Active())
+	}
+
+	if err := g.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	if err := g.Close(); err != kvl.ErrClosed {
+		t.Errorf("Second Close returned %v", err)
+	}
+	if err := g.Enter(); err != kvl.ErrClosed {
+		t.Errorf("Enter on closed gate returned %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait with an active operation returned %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		g.Leave()
+	}()
+	if err := g.Wait(context.Background()); err != nil {
+		t.Errorf("Wait returned %v", err)
+	}
+	if g.Active() != 0 {
+		t.Errorf("Active() = %v, wanted 0", g.Active())
+	}
+}
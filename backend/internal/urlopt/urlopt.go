@@ -0,0 +1,167 @@
+// Package urlopt parses backend options from the query parameters of the URLs
+// passed to kvl.OpenURL.
+package urlopt
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/encryptio/kvl"
+)
+
+// A Parser reads typed options from query parameters, remembering the first
+// error. Parameters that are not present leave their targets unchanged.
+type Parser struct {
+	values url.Values
+	used   map[string]bool
+	err    error
+}
+
+// New returns a Parser for the query parameters of u.
+func New(u *url.URL) *Parser {
+	return &Parser{values: u.Query(), used: make(map[string]bool)}
+}
+
+func (p *Parser) get(name string) (string, bool) {
+	p.used[name] = true
+	vs, ok := p.values[name]
+	if !ok || p.err != nil {
+		return "", false
+	}
+	return vs[len(vs)-1], true
+}
+
+func (p *Parser) fail(name, value string, err error) {
+	p.err = fmt.Errorf("bad value %q for URL parameter %v: %v", value, name, err)
+}
+
+// Bool parses "1", "true", "0", "false" and so on. An empty value is true.
+func (p *Parser) Bool(name string, target *bool) {
+	s, ok := p.get(name)
+	if !ok {
+		return
+	}
+	if s == "" {
+		*target = true
+		return
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		p.fail(name, s, err)
+		return
+	}
+	*target = v
+}
+
+func (p *Parser) Int(name string, target *int) {
+	s, ok := p.get(name)
+	if !ok {
+		return
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		p.fail(name, s, err)
+		return
+	}
+	*target = v
+}
+
+func (p *Parser) Int64(name string, target *int64) {
+	s, ok := p.get(name)
+	if !ok {
+		return
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		p.fail(name, s, err)
+		return
+	}
+	*target = v
+}
+
+// Duration parses durations like "1.5s".
+func (p *Parser) Duration(name string, target *time.Duration) {
+	s, ok := p.get(name)
+	if !ok {
+		return
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		p.fail(name, s, err)
+		return
+	}
+	*target = v
+}
+
+// FileMode parses octal permissions like "0600".
+func (p *Parser) FileMode(name string, target *os.FileMode) {
+	s, ok := p.get(name)
+	if !ok {
+		return
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		p.fail(name, s, err)
+		return
+	}
+	*target = os.FileMode(v)
+}
+
+// Limits reads the transaction limits max_writes, max_write_bytes,
+// max_key_size and max_value_size.
+func (p *Parser) Limits(target *kvl.Limits) {
+	p.Int("max_writes", &target.MaxWrites)
+	p.Int64("max_write_bytes", &target.MaxWriteBytes)
+	p.Int("max_key_size", &target.MaxKeySize)
+	p.Int("max_value_size", &target.MaxValueSize)
+}
+
+// Remaining returns the parameters not read by any method, for passing on to
+// a lower layer.
+func (p *Parser) Remaining() url.Values {
+	rest := make(url.Values)
+	for k, vs := range p.values {
+		if !p.used[k] {
+			rest[k] = vs
+		}
+	}
+	return rest
+}
+
+// Err returns the first parsing error.
+func (p *Parser) Err() error {
+	return p.err
+}
+
+// Done returns the first parsing error, or an error naming the parameters not
+// read by any method.
+func (p *Parser) Done() error {
+	if p.err != nil {
+		return p.err
+	}
+
+	var unknown []string
+	for k := range p.Remaining() {
+		unknown = append(unknown, k)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown URL parameters: %v", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Path returns the file path of a URL: the path of "scheme:///abs/path" or
+// "scheme://host/rel" forms joined back together, or the opaque part of
+// "scheme:rel/path".
+func Path(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Host + u.Path
+}
@@ -0,0 +1,72 @@
+package urlopt
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatalf("Couldn't parse %q: %v", s, err)
+	}
+	return u
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		url, path string
+	}{
+		{"bolt:///var/db.bolt", "/var/db.bolt"},
+		{"bolt:rel/db.bolt", "rel/db.bolt"},
+		{"bolt://rel/db.bolt", "rel/db.bolt"},
+		{"ram:", ""},
+		{"ram://", ""},
+		{"bolt:///var/db.bolt?nosync=1", "/var/db.bolt"},
+	}
+	for _, test := range tests {
+		got := Path(mustParse(t, test.url))
+		if got != test.path {
+			t.Errorf("Path(%q) = %q, wanted %q", test.url, got, test.path)
+		}
+	}
+}
+
+func TestParser(t *testing.T) {
+	u := mustParse(t, "x:?a&b=false&n=12&d=1.5s&m=0640&extra=1")
+	p := New(u)
+
+	var a, b bool = false, true
+	var n int
+	var d time.Duration
+	var m os.FileMode
+	p.Bool("a", &a)
+	p.Bool("b", &b)
+	p.Int("n", &n)
+	p.Duration("d", &d)
+	p.FileMode("m", &m)
+
+	if !a || b || n != 12 || d != 1500*time.Millisecond || m != 0640 {
+		t.Errorf("Parsed a=%v b=%v n=%v d=%v m=%v", a, b, n, d, m)
+	}
+	if err := p.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+	if err := p.Done(); err == nil {
+		t.Errorf("Done() did not report the unknown parameter")
+	}
+	if rest := p.Remaining(); rest.Encode() != "extra=1" {
+		t.Errorf("Remaining() = %v", rest)
+	}
+
+	p = New(mustParse(t, "x:?n=twelve"))
+	p.Int("n", &n)
+	if p.Err() == nil {
+		t.Errorf("Bad int did not fail")
+	}
+	if n != 12 {
+		t.Errorf("Bad int changed target to %v", n)
+	}
+}
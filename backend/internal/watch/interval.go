@@ -0,0 +1,197 @@
+package watch
+
+import (
+	"sort"
+)
+
+// highAbove reports whether key is below the (exclusive) upper bound high. An
+// empty high is unbounded.
+func highAbove(high, key string) bool {
+	return high == "" || key < high
+}
+
+// maxHigh returns the greater of two upper bounds, treating "" as unbounded.
+func maxHigh(a, b string) string {
+	if a == "" || b == "" {
+		return ""
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type rangesByLow []Range
+
+func (s rangesByLow) Len() int           { return len(s) }
+func (s rangesByLow) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s rangesByLow) Less(i, j int) bool { return s[i].Low < s[j].Low }
+
+// MergeRanges returns a sorted list of disjoint, non-empty ranges covering the
+// same keys as rs.
+func MergeRanges(rs []Range) []Range {
+	sorted := make([]Range, 0, len(rs))
+	for _, r := range rs {
+		if r.High != "" && r.Low >= r.High {
+			continue
+		}
+		sorted = append(sorted, r)
+	}
+	sort.Sort(rangesByLow(sorted))
+
+	merged := sorted[:0]
+	for _, r := range sorted {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if last.High == "" || r.Low <= last.High {
+				last.High = maxHigh(last.High, r.High)
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// RangesContain reports whether key is in any of the ranges, which must be
+// sorted and disjoint as returned by MergeRanges.
+func RangesContain(rs []Range, key string) bool {
+	// first range with low > key; the one before it is the only candidate
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].Low > key })
+	return i > 0 && highAbove(rs[i-1].High, key)
+}
+
+// intervalTree is a set of (range, watcher) entries supporting lookups of all
+// entries whose range contains a given key.
+//
+// It is a treap ordered by (low, watcher id), with each node augmented by the
+// maximum upper bound in its subtree.
+type intervalTree struct {
+	root *intervalNode
+	seed uint32
+}
+
+type intervalNode struct {
+	r           Range
+	w           *Watcher
+	priority    uint32
+	maxHigh     string
+	left, right *intervalNode
+}
+
+func intervalLess(r Range, w *Watcher, n *intervalNode) bool {
+	if r.Low != n.r.Low {
+		return r.Low < n.r.Low
+	}
+	return w.id < n.w.id
+}
+
+func (n *intervalNode) fix() {
+	n.maxHigh = n.r.High
+	if n.left != nil {
+		n.maxHigh = maxHigh(n.maxHigh, n.left.maxHigh)
+	}
+	if n.right != nil {
+		n.maxHigh = maxHigh(n.maxHigh, n.right.maxHigh)
+	}
+}
+
+func (t *intervalTree) insert(r Range, w *Watcher) {
+	// xorshift32
+	t.seed ^= t.seed << 13
+	t.seed ^= t.seed >> 17
+	t.seed ^= t.seed << 5
+	if t.seed == 0 {
+		t.seed = 2463534242
+	}
+
+	t.root = t.root.insert(&intervalNode{r: r, w: w, priority: t.seed, maxHigh: r.High})
+}
+
+func (n *intervalNode) insert(x *intervalNode) *intervalNode {
+	if n == nil {
+		return x
+	}
+
+	if intervalLess(x.r, x.w, n) {
+		n.left = n.left.insert(x)
+		if n.left.priority > n.priority {
+			l := n.left
+			n.left = l.right
+			n.fix()
+			l.right = n
+			n = l
+		}
+	} else {
+		n.right = n.right.insert(x)
+		if n.right.priority > n.priority {
+			r := n.right
+			n.right = r.left
+			n.fix()
+			r.left = n
+			n = r
+		}
+	}
+	n.fix()
+	return n
+}
+
+func (t *intervalTree) remove(r Range, w *Watcher) {
+	t.root = t.root.remove(r, w)
+}
+
+func (n *intervalNode) remove(r Range, w *Watcher) *intervalNode {
+	if n == nil {
+		return nil
+	}
+
+	if n.w == w && n.r.Low == r.Low {
+		return joinIntervals(n.left, n.right)
+	}
+
+	if intervalLess(r, w, n) {
+		n.left = n.left.remove(r, w)
+	} else {
+		n.right = n.right.remove(r, w)
+	}
+	n.fix()
+	return n
+}
+
+func joinIntervals(l, r *intervalNode) *intervalNode {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+
+	if l.priority > r.priority {
+		l.right = joinIntervals(l.right, r)
+		l.fix()
+		return l
+	}
+
+	r.left = joinIntervals(l, r.left)
+	r.fix()
+	return r
+}
+
+// stab calls fn for each entry whose range contains key.
+func (t *intervalTree) stab(key string, fn func(*Watcher)) {
+	t.root.stab(key, fn)
+}
+
+func (n *intervalNode) stab(key string, fn func(*Watcher)) {
+	if n == nil || !highAbove(n.maxHigh, key) {
+		return
+	}
+
+	n.left.stab(key, fn)
+	if n.r.Low <= key {
+		if highAbove(n.r.High, key) {
+			fn(n.w)
+		}
+		n.right.stab(key, fn)
+	}
+}
@@ -0,0 +1,94 @@
+package watch
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func randRange(r *rand.Rand) Range {
+	kr := Range{strconv.Itoa(r.Intn(100)), strconv.Itoa(r.Intn(100))}
+	if r.Intn(5) == 0 {
+		kr.High = ""
+	}
+	if r.Intn(5) == 0 {
+		kr.Low = ""
+	}
+	return kr
+}
+
+func inRange(kr Range, k string) bool {
+	return k >= kr.Low && highAbove(kr.High, k)
+}
+
+func TestMergeRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		rs := make([]Range, r.Intn(6))
+		for j := range rs {
+			rs[j] = randRange(r)
+		}
+		merged := MergeRanges(append([]Range(nil), rs...))
+
+		for j := 0; j < 50; j++ {
+			k := strconv.Itoa(r.Intn(110))
+			want := false
+			for _, kr := range rs {
+				if inRange(kr, k) {
+					want = true
+				}
+			}
+			if got := RangesContain(merged, k); got != want {
+				t.Fatalf("RangesContain(MergeRanges(%v) = %v, %q) = %v, wanted %v",
+					rs, merged, k, got, want)
+			}
+		}
+	}
+}
+
+func TestIntervalTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	type entry struct {
+		r Range
+		w *Watcher
+	}
+	var tree intervalTree
+	var entries []entry
+
+	for i := 0; i < 2000; i++ {
+		if len(entries) > 0 && r.Intn(3) == 0 {
+			j := r.Intn(len(entries))
+			tree.remove(entries[j].r, entries[j].w)
+			entries = append(entries[:j], entries[j+1:]...)
+		} else {
+			e := entry{randRange(r), &Watcher{id: uint64(i)}}
+			tree.insert(e.r, e.w)
+			entries = append(entries, e)
+		}
+
+		k := strconv.Itoa(r.Intn(110))
+		var want, got []uint64
+		for _, e := range entries {
+			if inRange(e.r, k) {
+				want = append(want, e.w.id)
+			}
+		}
+		tree.stab(k, func(w *Watcher) {
+			got = append(got, w.id)
+		})
+		sort.Sort(uint64Slice(want))
+		sort.Sort(uint64Slice(got))
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("stab(%q) = %v, wanted %v", k, got, want)
+		}
+	}
+}
+
+type uint64Slice []uint64
+
+func (s uint64Slice) Len() int           { return len(s) }
+func (s uint64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s uint64Slice) Less(i, j int) bool { return s[i] < s[j] }
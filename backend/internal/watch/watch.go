@@ -0,0 +1,287 @@
+// Package watch tracks the keys and ranges read by transactions, and
+// implements in-process watches on them for backends that see every commit
+// made to their database.
+package watch
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/encryptio/kvl"
+)
+
+// A Range is a range of keys [Low, High). An empty High is unbounded.
+type Range struct {
+	Low, High string
+}
+
+// A ReadSet is the set of keys and ranges read by a transaction.
+type ReadSet struct {
+	Keys   []string
+	Ranges []Range
+}
+
+// AddKey records a read of a single key.
+func (rs *ReadSet) AddKey(key string) {
+	rs.Keys = append(rs.Keys, key)
+}
+
+// AddRange records a range query and its result.
+//
+// If the Limit of the query was reached, keys past the last one returned (in
+// the direction of the query) could not have changed the result, so they are
+// not included in the recorded range.
+func (rs *ReadSet) AddRange(query kvl.RangeQuery, pairs []kvl.Pair) {
+	r := Range{string(query.Low), string(query.High)}
+
+	if query.Limit > 0 && len(pairs) >= query.Limit {
+		last := string(pairs[len(pairs)-1].Key)
+		if query.Descending {
+			r.Low = last
+		} else {
+			r.High = last + "\x00"
+		}
+	}
+
+	rs.Ranges = append(rs.Ranges, r)
+}
+
+// An Index is a ReadSet prepared for checking many keys against it.
+type Index struct {
+	keys   map[string]struct{}
+	ranges []Range // sorted and disjoint
+}
+
+// Index builds an Index of the ReadSet.
+func (rs ReadSet) Index() Index {
+	keys := make(map[string]struct{}, len(rs.Keys))
+	for _, k := range rs.Keys {
+		keys[k] = struct{}{}
+	}
+	return Index{keys, MergeRanges(rs.Ranges)}
+}
+
+// Contains reports whether the key was read. It takes O(log(len(ranges)))
+// time.
+func (ix Index) Contains(key string) bool {
+	if _, found := ix.keys[key]; found {
+		return true
+	}
+	return RangesContain(ix.ranges, key)
+}
+
+// A Registry is a set of watches, indexed by the keys and ranges they depend
+// on.
+type Registry struct {
+	mu       sync.Mutex
+	watchers map[*Watcher]struct{}
+	keys     map[string]map[*Watcher]struct{}
+	ranges   intervalTree
+	nextID   uint64
+	closed   error // set by Close
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		watchers: make(map[*Watcher]struct{}),
+		keys:     make(map[string]map[*Watcher]struct{}),
+	}
+}
+
+// Watch returns a new Watcher which is triggered when any key read in rs is
+// passed to Trigger.
+//
+// To avoid missing changes, the caller must ensure that no commit can happen
+// between the start of the transaction that read rs and the call to Watch
+// without being passed to Trigger afterwards.
+func (r *Registry) Watch(rs ReadSet) *Watcher {
+	ix := rs.Index()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	w := &Watcher{
+		r:     r,
+		id:    r.nextID,
+		index: ix,
+		done:  make(chan struct{}),
+	}
+
+	if r.closed != nil {
+		w.err = r.closed
+		close(w.done)
+		return w
+	}
+
+	r.watchers[w] = struct{}{}
+	for k := range ix.keys {
+		m := r.keys[k]
+		if m == nil {
+			m = make(map[*Watcher]struct{}, 1)
+			r.keys[k] = m
+		}
+		m[w] = struct{}{}
+	}
+	for _, kr := range ix.ranges {
+		r.ranges.insert(kr, w)
+	}
+
+	return w
+}
+
+func (r *Registry) removeLocked(w *Watcher) {
+	delete(r.watchers, w)
+	for k := range w.index.keys {
+		m := r.keys[k]
+		delete(m, w)
+		if len(m) == 0 {
+			delete(r.keys, k)
+		}
+	}
+	for _, kr := range w.index.ranges {
+		r.ranges.remove(kr, w)
+	}
+}
+
+// Trigger fires and removes all watchers depending on any of the written keys,
+// recording the keys each one depended on and the version of the database
+// created by the commit that wrote them.
+//
+// It takes time proportional to the number of written keys (times the log of
+// the number of watched ranges) plus the number of watchers fired.
+func (r *Registry) Trigger(written []string, version uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fired := make(map[*Watcher][]string)
+	var key string
+	fire := func(w *Watcher) {
+		keys := fired[w]
+		if len(keys) > 0 && keys[len(keys)-1] == key {
+			// found by both key and range
+			return
+		}
+		fired[w] = append(keys, key)
+	}
+
+	for _, key = range written {
+		for w := range r.keys[key] {
+			fire(w)
+		}
+		r.ranges.stab(key, fire)
+	}
+
+	for w, keys := range fired {
+		// watchers still in the registry have not finished, so their changes
+		// can be set before finishLocked closes done
+		w.changed = keys
+		w.version = version
+		w.hasChanges = true
+		r.finishLocked(w, nil)
+	}
+}
+
+// FailAll fires and removes all watchers, making their Error methods return
+// err.
+func (r *Registry) FailAll(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for w := range r.watchers {
+		r.finishLocked(w, err)
+	}
+}
+
+// Close fires and removes all watchers like FailAll, and makes later calls to
+// Watch return watchers that have already failed with err.
+func (r *Registry) Close(err error) {
+	r.mu.Lock()
+	r.closed = err
+	r.mu.Unlock()
+
+	r.FailAll(err)
+}
+
+// Len returns the number of watchers that have not fired.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.watchers)
+}
+
+// finishLocked fires the watcher, unless it was already fired.
+func (r *Registry) finishLocked(w *Watcher, err error) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	w.err = err
+	close(w.done)
+	r.removeLocked(w)
+}
+
+// A Watcher is a kvl.ChangeWatchResult for a watch in a Registry.
+type Watcher struct {
+	r     *Registry
+	id    uint64
+	index Index
+	done  chan struct{}
+
+	// set before done is closed
+	err        error
+	changed    []string
+	version    uint64
+	hasChanges bool
+}
+
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *Watcher) Error() error {
+	select {
+	case <-w.done:
+		return w.err
+	default:
+		return nil
+	}
+}
+
+func (w *Watcher) Changes() ([][]byte, uint64, bool) {
+	select {
+	case <-w.done:
+	default:
+		return nil, 0, false
+	}
+
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+
+	if !w.hasChanges {
+		return nil, 0, false
+	}
+
+	sort.Strings(w.changed)
+	keys := make([][]byte, len(w.changed))
+	for i, k := range w.changed {
+		keys[i] = []byte(k)
+	}
+	return keys, w.version, true
+}
+
+// Fire closes the Done channel and removes the watcher from its Registry,
+// making Error return err.
+func (w *Watcher) Fire(err error) {
+	w.r.mu.Lock()
+	w.r.finishLocked(w, err)
+	w.r.mu.Unlock()
+}
+
+func (w *Watcher) Close() {
+	w.r.mu.Lock()
+	w.r.finishLocked(w, nil)
+	w.r.mu.Unlock()
+}
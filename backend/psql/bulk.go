@@ -0,0 +1,132 @@
+package psql
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/encryptio/kvl"
+)
+
+// BulkLoad writes each batch in one transaction, by COPYing it into a
+// temporary staging table and merging that into the data table with a single
+// statement. Batches that conflict with concurrent transactions are retried.
+func (db *DB) BulkLoad(src kvl.PairSource, opts *kvl.BulkOptions) (kvl.BulkStats, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return kvl.BulkStats{}, err
+	}
+	defer db.gate.Leave()
+
+	failIfExists := opts != nil && opts.FailIfExists
+	return kvl.BulkBatches(src, opts, func(batch []kvl.Pair) error {
+		for _, p := range batch {
+			_, err := db.limits.Add(kvl.TxSize{}, p.Key, p.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		for {
+			err, again := db.tryBulkBatch(batch, failIfExists)
+			if !again {
+				return err
+			}
+		}
+	})
+}
+
+func (db *DB) tryBulkBatch(batch []kvl.Pair, failIfExists bool) (error, bool) {
+	sqlTx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err, false
+	}
+
+	// only used for its retry detection
+	c := &ctx{sqlTx: sqlTx}
+
+	err = loadBatch(sqlTx, batch, failIfExists)
+	if err != nil {
+		c.checkErr(err)
+		err2 := sqlTx.Rollback()
+		c.checkErr(err2)
+		return err, c.needsRetry
+	}
+
+	err = sqlTx.Commit()
+	c.checkErr(err)
+	return err, c.needsRetry
+}
+
+func loadBatch(sqlTx *sql.Tx, batch []kvl.Pair, failIfExists bool) error {
+	_, err := sqlTx.Exec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE")
+	if err != nil {
+		return err
+	}
+
+	// seq keeps the order of the batch, so the last of several pairs with
+	// the same key can be found
+	_, err = sqlTx.Exec(
+		"CREATE TEMPORARY TABLE kvl_bulk (" +
+			"    seq serial," +
+			"    key bytea not null," +
+			"    value bytea not null" +
+			") ON COMMIT DROP")
+	if err != nil {
+		return err
+	}
+
+	stmt, err := sqlTx.Prepare(pq.CopyIn("kvl_bulk", "key", "value"))
+	if err != nil {
+		return err
+	}
+	for _, p := range batch {
+		_, err = stmt.Exec(p.Key, p.Value)
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		stmt.Close()
+		return err
+	}
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	if failIfExists {
+		var key []byte
+		row := sqlTx.QueryRow(
+			"SELECT key FROM kvl_bulk s " +
+				"WHERE EXISTS (SELECT * FROM data WHERE data.key = s.key) " +
+				"    OR EXISTS (SELECT * FROM kvl_bulk o WHERE o.key = s.key AND o.seq < s.seq) " +
+				"ORDER BY seq LIMIT 1")
+		err = row.Scan(&key)
+		if err == nil {
+			return &kvl.KeyExistsError{Key: key}
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		_, err = sqlTx.Exec("INSERT INTO data (key, value) SELECT key, value FROM kvl_bulk")
+		return err
+	}
+
+	// Upsert, like ctx.Set, keeping the last value of each key
+	_, err = sqlTx.Exec(
+		"WITH " +
+			"staged AS (" +
+			"    SELECT DISTINCT ON (key) key, value FROM kvl_bulk ORDER BY key, seq DESC" +
+			"), " +
+			"upsert AS (" +
+			"    UPDATE data SET value = staged.value FROM staged" +
+			"        WHERE data.key = staged.key RETURNING data.key" +
+			") " +
+			"INSERT INTO data (key, value) SELECT key, value FROM staged " +
+			"    WHERE key NOT IN (SELECT key FROM upsert)")
+	return err
+}
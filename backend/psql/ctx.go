@@ -7,12 +7,25 @@ import (
 	"github.com/lib/pq"
 
 	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/watch"
 )
 
 type ctx struct {
 	sqlTx      *sql.Tx
 	needsRetry bool
 	readonly   bool
+	reads      *watch.ReadSet // if non-nil, reads are recorded for a watch
+	info       kvl.TxInfo
+	limits     kvl.Limits
+	size       kvl.TxSize
+}
+
+func (c *ctx) TxInfo() kvl.TxInfo {
+	return c.info
+}
+
+func (c *ctx) TxSize() kvl.TxSize {
+	return c.size
 }
 
 func (c *ctx) checkErr(err error) {
@@ -31,6 +44,10 @@ func (c *ctx) checkErr(err error) {
 func (c *ctx) Get(key []byte) (kvl.Pair, error) {
 	var p kvl.Pair
 
+	if c.reads != nil {
+		c.reads.AddKey(string(key))
+	}
+
 	row := c.sqlTx.QueryRow("SELECT key, value FROM data WHERE key = $1", key)
 	err := row.Scan(&p.Key, &p.Value)
 	if err != nil {
@@ -49,8 +66,13 @@ func (c *ctx) Set(p kvl.Pair) error {
 		return kvl.ErrReadOnlyTx
 	}
 
+	size, err := c.limits.Add(c.size, p.Key, p.Value)
+	if err != nil {
+		return err
+	}
+
 	// Upsert
-	_, err := c.sqlTx.Exec(
+	_, err = c.sqlTx.Exec(
 		"WITH "+
 			"upsert AS ("+
 			"    UPDATE data SET value = $2 WHERE key = $1 RETURNING *"+
@@ -62,6 +84,7 @@ func (c *ctx) Set(p kvl.Pair) error {
 		return err
 	}
 
+	c.size = size
 	return nil
 }
 
@@ -70,6 +93,11 @@ func (c *ctx) Delete(key []byte) error {
 		return kvl.ErrReadOnlyTx
 	}
 
+	size, err := c.limits.Add(c.size, key, nil)
+	if err != nil {
+		return err
+	}
+
 	res, err := c.sqlTx.Exec("DELETE FROM data WHERE key = $1", key)
 	if err != nil {
 		c.checkErr(err)
@@ -90,6 +118,7 @@ func (c *ctx) Delete(key []byte) error {
 		panic("single deletion matched multiple rows")
 	}
 
+	c.size = size
 	return nil
 }
 
@@ -137,5 +166,9 @@ func (c *ctx) Range(q kvl.RangeQuery) ([]kvl.Pair, error) {
 		return nil, err
 	}
 
+	if c.reads != nil {
+		c.reads.AddRange(q, pairs)
+	}
+
 	return pairs, nil
 }
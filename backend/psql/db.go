@@ -1,30 +1,84 @@
 package psql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/gate"
+	"github.com/encryptio/kvl/backend/internal/urlopt"
+	"github.com/encryptio/kvl/backend/internal/watch"
 )
 
 func init() {
-	kvl.RegisterBackend("postgresql", Open)
+	kvl.Register(kvl.Backend{
+		Name:        "postgresql",
+		Description: "a PostgreSQL server; DSN is a lib/pq connection string or URL",
+		Open:        Open,
+		OpenURL:     openURL,
+	})
 }
 
 type DB struct {
+	nextTxID uint64 // atomic; first for alignment
+
 	sqlDB *sql.DB
+	dsn   string
+
+	listenMu sync.Mutex
+	listener *pq.Listener // started by the first WatchTx
+
+	watchMu sync.Mutex
+	watches *watch.Registry
+	pending map[*pendingWatch]struct{}
+
+	gate   gate.Gate
+	limits kvl.Limits
+}
+
+// Options configures the connection pool of a DB.
+type Options struct {
+	// MaxOpenConns limits the number of connections to the server. Zero
+	// means no limit.
+	MaxOpenConns int
+
+	// MaxIdleConns is the number of idle connections kept open. Zero means
+	// database/sql's default.
+	MaxIdleConns int
+
+	// Limits bounds the writes of each transaction.
+	Limits kvl.Limits
 }
 
 func Open(dsn string) (kvl.DB, error) {
+	return OpenOptions(dsn, nil)
+}
+
+// OpenOptions connects to the server described by dsn, creating the table
+// and triggers if needed.
+func OpenOptions(dsn string, opts *Options) (kvl.DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
 	sqlDB, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns != 0 {
+		sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
+	}
 
 	err = sqlDB.Ping()
 	if err != nil {
@@ -32,7 +86,13 @@ func Open(dsn string) (kvl.DB, error) {
 		return nil, err
 	}
 
-	db := &DB{sqlDB: sqlDB}
+	db := &DB{
+		sqlDB:   sqlDB,
+		dsn:     dsn,
+		watches: watch.NewRegistry(),
+		pending: make(map[*pendingWatch]struct{}),
+		limits:  opts.Limits,
+	}
 
 	err = db.ensureVersion()
 	if err != nil {
@@ -46,11 +106,84 @@ func Open(dsn string) (kvl.DB, error) {
 		return nil, err
 	}
 
+	err = db.ensureNotifyTrigger()
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// openURL opens postgresql:// URLs, reading the query parameters
+// max_open_conns, max_idle_conns and the limits read by urlopt.Parser.Limits,
+// and passing the rest on to lib/pq.
+func openURL(u *url.URL) (kvl.DB, error) {
+	var opts Options
+	p := urlopt.New(u)
+	p.Int("max_open_conns", &opts.MaxOpenConns)
+	p.Int("max_idle_conns", &opts.MaxIdleConns)
+	p.Limits(&opts.Limits)
+	err := p.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	dsn := *u
+	dsn.RawQuery = p.Remaining().Encode()
+	return OpenOptions(dsn.String(), &opts)
+}
+
+// Close is Shutdown with a timeout of kvl.CloseTimeout.
 func (db *DB) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), kvl.CloseTimeout)
+	defer cancel()
+	db.Shutdown(ctx)
+}
+
+// Shutdown closes the DB as described by kvl.ShutdownDB. Transactions still
+// running when ctx is done fail when the connection pool is closed.
+func (db *DB) Shutdown(ctx context.Context) error {
+	err := db.gate.Close()
+	if err != nil {
+		return err
+	}
+	db.failWatches(kvl.ErrClosed)
+	db.watches.Close(kvl.ErrClosed)
+
+	err = db.gate.Wait(ctx)
+	db.closeListener()
 	db.sqlDB.Close()
+	return err
+}
+
+// Ping returns kvl.ErrClosed if the DB is closed, or any error from reaching
+// the server.
+func (db *DB) Ping() error {
+	if db.gate.Closed() {
+		return kvl.ErrClosed
+	}
+	return db.sqlDB.Ping()
+}
+
+// Stats reports the server's estimates of the row count and the size of the
+// data table, including its index and TOAST data, and the sql.DBStats of the
+// connection pool as Backend.
+func (db *DB) Stats() kvl.Stats {
+	stats := kvl.Stats{
+		Transactions: db.gate.Active(),
+		Watches:      db.watches.Len(),
+		Backend:      db.sqlDB.Stats(),
+	}
+	row := db.sqlDB.QueryRow(
+		"SELECT reltuples::bigint, pg_total_relation_size(oid) " +
+			"FROM pg_class WHERE oid = 'data'::regclass")
+	err := row.Scan(&stats.Keys, &stats.Bytes)
+	if err != nil {
+		stats.Keys = -1
+		stats.Bytes = -1
+	}
+	return stats
 }
 
 type errOldServer struct {
@@ -125,8 +258,16 @@ func (db *DB) ensureTable() error {
 }
 
 func (db *DB) RunTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	info := db.newTxInfo(false)
 	for {
-		err, again := db.tryTx(tx, false)
+		info.Attempt++
+		err, again := db.tryTx(tx, info, nil)
 		if !again {
 			return err
 		}
@@ -134,15 +275,42 @@ func (db *DB) RunTx(tx kvl.Tx) error {
 }
 
 func (db *DB) RunReadTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	info := db.newTxInfo(true)
 	for {
-		err, again := db.tryTx(tx, true)
+		info.Attempt++
+		err, again := db.tryTx(tx, info, nil)
 		if !again {
 			return err
 		}
 	}
 }
 
-func (db *DB) tryTx(tx kvl.Tx, readonly bool) (error, bool) {
+func (db *DB) Capabilities() kvl.Capabilities {
+	return kvl.Capabilities{
+		Watch:        true,
+		Durable:      true,
+		MultiProcess: true,
+	}
+}
+
+// newTxInfo describes a new transaction. The version it reads is not known.
+func (db *DB) newTxInfo(readonly bool) kvl.TxInfo {
+	return kvl.TxInfo{
+		ID:       atomic.AddUint64(&db.nextTxID, 1),
+		ReadOnly: readonly,
+		Start:    time.Now(),
+	}
+}
+
+func (db *DB) tryTx(tx kvl.Tx, info kvl.TxInfo, reads *watch.ReadSet) (error, bool) {
+	readonly := info.ReadOnly
+
 	sqlTx, err := db.sqlDB.Begin()
 	if err != nil {
 		return err, false
@@ -158,7 +326,13 @@ func (db *DB) tryTx(tx kvl.Tx, readonly bool) (error, bool) {
 		return err, false
 	}
 
-	ctx := &ctx{sqlTx: sqlTx, readonly: readonly}
+	ctx := &ctx{
+		sqlTx:    sqlTx,
+		readonly: readonly,
+		reads:    reads,
+		info:     info,
+		limits:   db.limits,
+	}
 
 	err = tx(ctx)
 	if err != nil {
@@ -173,7 +347,3 @@ func (db *DB) tryTx(tx kvl.Tx, readonly bool) (error, bool) {
 	ctx.checkErr(err)
 	return err, ctx.needsRetry
 }
-
-func (db *DB) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
-	return nil, kvl.ErrWatchUnsupported
-}
@@ -0,0 +1,242 @@
+package psql
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/watch"
+)
+
+const (
+	notifyChannel = "kvl_data"
+
+	// pg_notify payloads must be shorter than 8000 bytes. Keys longer than
+	// this are sent as an empty payload, which triggers every watch.
+	maxNotifyKeyLength = 3900
+)
+
+var (
+	ErrListenerConnectionLost = errors.New("lost connection to PostgreSQL while watching for changes")
+
+	errListenerClosed = errors.New("DB closed while watching for changes")
+)
+
+func (db *DB) ensureNotifyTrigger() error {
+	_, err := db.sqlDB.Exec(
+		"CREATE OR REPLACE FUNCTION kvl_notify_change() RETURNS trigger AS $$\n" +
+			"DECLARE\n" +
+			"    k bytea;\n" +
+			"BEGIN\n" +
+			"    IF TG_OP = 'DELETE' THEN\n" +
+			"        k := OLD.key;\n" +
+			"    ELSE\n" +
+			"        k := NEW.key;\n" +
+			"    END IF;\n" +
+			"    IF length(k) > " + strconv.Itoa(maxNotifyKeyLength) + " THEN\n" +
+			"        PERFORM pg_notify('" + notifyChannel + "', '');\n" +
+			"    ELSE\n" +
+			"        PERFORM pg_notify('" + notifyChannel + "', encode(k, 'hex'));\n" +
+			"    END IF;\n" +
+			"    RETURN NULL;\n" +
+			"END;\n" +
+			"$$ LANGUAGE plpgsql")
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = db.sqlDB.QueryRow(
+		"SELECT count(*) FROM pg_trigger " +
+			"WHERE tgname = 'kvl_notify_change' AND tgrelid = 'data'::regclass").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.sqlDB.Exec(
+		"CREATE TRIGGER kvl_notify_change " +
+			"AFTER INSERT OR UPDATE OR DELETE ON data " +
+			"FOR EACH ROW EXECUTE PROCEDURE kvl_notify_change()")
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "42710" {
+		// duplicate_object; another process created it concurrently
+		return nil
+	}
+	return err
+}
+
+// pendingWatch collects the notifications that arrive while a watched
+// transaction runs, before its read set is known.
+type pendingWatch struct {
+	keys []string
+	all  bool
+	err  error
+}
+
+// startListener starts the LISTEN connection if it isn't already running.
+func (db *DB) startListener() error {
+	db.listenMu.Lock()
+	defer db.listenMu.Unlock()
+
+	if db.listener != nil {
+		return nil
+	}
+
+	listener := pq.NewListener(db.dsn, 100*time.Millisecond, 10*time.Second,
+		func(ev pq.ListenerEventType, err error) {
+			if ev == pq.ListenerEventDisconnected {
+				// notifications may be missed until the connection is
+				// re-established, so all current watches must fail
+				db.failWatches(ErrListenerConnectionLost)
+			}
+		})
+
+	err := listener.Listen(notifyChannel)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	db.listener = listener
+	go db.dispatchNotifications(listener)
+
+	return nil
+}
+
+func (db *DB) dispatchNotifications(listener *pq.Listener) {
+	for n := range listener.Notify {
+		if n == nil {
+			// reconnected; notifications may have been lost
+			db.failWatches(ErrListenerConnectionLost)
+			continue
+		}
+
+		if n.Channel != notifyChannel {
+			continue
+		}
+
+		key, err := hex.DecodeString(n.Extra)
+		if err != nil || n.Extra == "" {
+			db.triggerAll()
+			continue
+		}
+
+		db.triggerKey(string(key))
+	}
+}
+
+func (db *DB) triggerKey(key string) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for p := range db.pending {
+		p.keys = append(p.keys, key)
+	}
+	db.watches.Trigger([]string{key}, 0)
+}
+
+func (db *DB) triggerAll() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for p := range db.pending {
+		p.all = true
+	}
+	db.watches.FailAll(nil)
+}
+
+func (db *DB) failWatches(err error) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for p := range db.pending {
+		p.all = true
+		p.err = err
+	}
+	db.watches.FailAll(err)
+}
+
+// WatchTx watches for changes to the data table made by any client of the
+// database, using a trigger that sends a NOTIFY for every changed key and a
+// dedicated LISTEN connection.
+//
+// If the LISTEN connection is lost, all current watches are closed and their
+// Error methods return ErrListenerConnectionLost.
+func (db *DB) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return nil, err
+	}
+	defer db.gate.Leave()
+
+	err = db.startListener()
+	if err != nil {
+		return nil, err
+	}
+
+	// Notifications for commits that the transaction might not see must not be
+	// lost, so start collecting them before the transaction starts.
+	p := &pendingWatch{}
+	db.watchMu.Lock()
+	db.pending[p] = struct{}{}
+	db.watchMu.Unlock()
+
+	var reads *watch.ReadSet
+	info := db.newTxInfo(true)
+	for {
+		reads = &watch.ReadSet{}
+		info.Attempt++
+		var again bool
+		err, again = db.tryTx(tx, info, reads)
+		if !again {
+			break
+		}
+	}
+
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	delete(db.pending, p)
+	if err != nil {
+		return nil, err
+	}
+
+	w := db.watches.Watch(*reads)
+	if p.all {
+		w.Fire(p.err)
+	} else {
+		ix := reads.Index()
+		for _, k := range p.keys {
+			if ix.Contains(k) {
+				w.Fire(nil)
+				break
+			}
+		}
+	}
+
+	// notifications carry no commit version, so hide w.Changes
+	return watchResult{w}, nil
+}
+
+type watchResult struct {
+	kvl.WatchResult
+}
+
+func (db *DB) closeListener() {
+	db.listenMu.Lock()
+	listener := db.listener
+	db.listener = nil
+	db.listenMu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+
+	db.failWatches(errListenerClosed)
+}
@@ -0,0 +1,45 @@
+package ram
+
+import (
+	"github.com/encryptio/kvl"
+)
+
+// BulkLoad inserts each batch directly into the head of the DB, without
+// running a transaction. Each batch is committed like a transaction that
+// writes its keys: it conflicts with concurrent transactions, triggers
+// watches, and is logged by durable DBs.
+func (db *DB) BulkLoad(src kvl.PairSource, opts *kvl.BulkOptions) (kvl.BulkStats, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return kvl.BulkStats{}, err
+	}
+	defer db.gate.Leave()
+
+	failIfExists := opts != nil && opts.FailIfExists
+	return kvl.BulkBatches(src, opts, func(batch []kvl.Pair) error {
+		for _, p := range batch {
+			_, err := db.limits.Add(kvl.TxSize{}, p.Key, p.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		tree := db.headData.tree
+		toCommit := make(map[string]*string, len(batch))
+		for _, p := range batch {
+			k, v := string(p.Key), string(p.Value)
+			if failIfExists && tree.get(k) != nil {
+				return &kvl.KeyExistsError{Key: p.Key}
+			}
+			tree = tree.set(k, v)
+			toCommit[k] = &v
+		}
+
+		err := db.commitLocked(toCommit, tree)
+		db.tryMerge()
+		return err
+	})
+}
@@ -0,0 +1,77 @@
+package ram
+
+import (
+	"github.com/encryptio/kvl"
+)
+
+// A Snapshot is a saved state of the contents of a DB, which can be restored
+// with DB.Restore.
+type Snapshot struct {
+	tree *node
+}
+
+// Snapshot saves the current contents of the DB. It takes O(1) time and
+// memory; the saved state shares structure with the DB.
+func (db *DB) Snapshot() Snapshot {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return Snapshot{db.headData.tree}
+}
+
+// RunSnapshotTx runs a read-only transaction on the current contents of the
+// DB. Since the contents are never modified in place, it never conflicts with
+// other transactions and is never retried.
+func (db *DB) RunSnapshotTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	db.mu.Lock()
+	head := db.headData
+	db.mu.Unlock()
+
+	info := db.newTxInfo(true)
+	info.Attempt = 1
+	return tx(newCtx(head, info, db.limits))
+}
+
+// Restore replaces the contents of the DB with a saved Snapshot, which may
+// have been taken from any DB.
+//
+// The restore is committed like a transaction that writes every key that
+// differs from the snapshot, so it conflicts with concurrent transactions,
+// triggers watches and is logged by durable DBs as such.
+func (db *DB) Restore(s Snapshot) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	toCommit := make(map[string]*string)
+	diffTrees(db.headData.tree, s.tree, func(k string, v *string) {
+		toCommit[k] = v
+	})
+
+	if len(toCommit) == 0 {
+		return nil
+	}
+
+	return db.commitLocked(toCommit, s.tree)
+}
+
+// Clone returns a new in-memory DB with the same contents as db. It takes O(1)
+// time, and the two DBs share structure until they are modified.
+//
+// Watches are not copied, and a clone of a durable DB is not durable.
+func (db *DB) Clone() *DB {
+	clone := New().(*DB)
+	clone.headData.tree = db.Snapshot().tree
+	clone.limits = db.limits
+	return clone
+}
@@ -1,47 +1,51 @@
 package ram
 
 import (
-	"bytes"
-	"sort"
-	"sync"
-
 	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/watch"
 )
 
-type keyRange struct{ low, high string }
-
 type ctx struct {
-	mu       *sync.RWMutex
 	data     *data
+	tree     *node // data.tree with toCommit applied
 	toCommit map[string]*string
-	locks    locks
+	locks    watch.ReadSet
 	aborted  bool
 	readonly bool
+	info     kvl.TxInfo
+	limits   kvl.Limits
+	size     kvl.TxSize
 }
 
-func newCtx(head *data, mu *sync.RWMutex, readonly bool) *ctx {
+func newCtx(head *data, info kvl.TxInfo, limits kvl.Limits) *ctx {
+	info.ReadVersion = head.version
+	info.HasReadVersion = true
 	return &ctx{
-		mu:       mu,
 		data:     head,
+		tree:     head.tree,
 		toCommit: make(map[string]*string),
-		readonly: readonly,
+		readonly: info.ReadOnly,
+		info:     info,
+		limits:   limits,
 	}
 }
 
+func (c *ctx) TxInfo() kvl.TxInfo {
+	return c.info
+}
+
+func (c *ctx) TxSize() kvl.TxSize {
+	return c.size
+}
+
 func (c *ctx) Get(key []byte) (kvl.Pair, error) {
 	sKey := string(key)
 
-	c.locks.keys = append(c.locks.keys, sKey)
-
-	v, ok := c.toCommit[string(sKey)]
-	if !ok {
-		c.mu.RLock()
-		v = c.data.get(sKey)
-		c.mu.RUnlock()
-	}
+	c.locks.AddKey(sKey)
 
+	v := c.tree.get(sKey)
 	if v != nil {
-		return kvl.Pair{[]byte(string(key)), []byte(*v)}, nil
+		return kvl.Pair{[]byte(sKey), []byte(*v)}, nil
 	}
 
 	return kvl.Pair{}, kvl.ErrNotFound
@@ -52,12 +56,19 @@ func (c *ctx) Set(p kvl.Pair) error {
 		return kvl.ErrReadOnlyTx
 	}
 
+	size, err := c.limits.Add(c.size, p.Key, p.Value)
+	if err != nil {
+		return err
+	}
+	c.size = size
+
 	sKey := string(p.Key)
 	sValue := string(p.Value)
 
-	c.locks.keys = append(c.locks.keys, sKey)
+	c.locks.AddKey(sKey)
 
 	c.toCommit[sKey] = &sValue
+	c.tree = c.tree.set(sKey, sValue)
 	return nil
 }
 
@@ -66,56 +77,45 @@ func (c *ctx) Delete(key []byte) error {
 		return kvl.ErrReadOnlyTx
 	}
 
-	_, err := c.Get(key) // NB: adds key to c.locks
+	size, err := c.limits.Add(c.size, key, nil)
 	if err != nil {
 		return err
 	}
 
+	_, err = c.Get(key) // NB: adds key to c.locks
+	if err != nil {
+		return err
+	}
+	c.size = size
+
 	sKey := string(key)
 	c.toCommit[sKey] = nil
+	c.tree = c.tree.delete(sKey)
 	return nil
 }
 
 func (c *ctx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
-	kr := keyRange{string(query.Low), string(query.High)}
-	c.locks.ranges = append(c.locks.ranges, kr)
-
-	c.mu.RLock()
-	mapParts := c.data.getRange(kr)
-	c.mu.RUnlock()
-
-	for k, v := range c.toCommit {
-		if k >= kr.low && (kr.high == "" || k < kr.high) {
-			mapParts[k] = v
-		}
+	var pairs []kvl.Pair
+	if query.Limit > 0 && query.Limit < 64 {
+		pairs = make([]kvl.Pair, 0, query.Limit)
 	}
 
-	sliceParts := make([]kvl.Pair, 0, len(mapParts))
-	for k, v := range mapParts {
-		if v == nil {
-			continue
-		}
-
-		sliceParts = append(sliceParts, kvl.Pair{[]byte(k), []byte(*v)})
+	fn := func(k, v string) bool {
+		pairs = append(pairs, kvl.Pair{[]byte(k), []byte(v)})
+		return query.Limit <= 0 || len(pairs) < query.Limit
 	}
 
 	if query.Descending {
-		sort.Sort(sort.Reverse(pairSlice(sliceParts)))
+		c.tree.descend(string(query.Low), string(query.High), fn)
 	} else {
-		sort.Sort(pairSlice(sliceParts))
+		c.tree.ascend(string(query.Low), string(query.High), fn)
 	}
 
-	if query.Limit > 0 && len(sliceParts) > query.Limit {
-		sliceParts = sliceParts[:query.Limit]
-	}
+	c.locks.AddRange(query, pairs)
 
-	return sliceParts, nil
-}
-
-type pairSlice []kvl.Pair
+	if pairs == nil {
+		pairs = []kvl.Pair{}
+	}
 
-func (s pairSlice) Len() int      { return len(s) }
-func (s pairSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
-func (s pairSlice) Less(i, j int) bool {
-	return bytes.Compare(s[i].Key, s[j].Key) < 0
+	return pairs, nil
 }
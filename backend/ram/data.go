@@ -1,69 +1,30 @@
 package ram
 
-// data is a linked list of map[string]*strings.
+import (
+	"github.com/encryptio/kvl/backend/internal/watch"
+)
+
+// data is a linked list of committed versions of the database, newest first.
+//
+// Each link holds the full contents of the database as of that version in an
+// immutable tree, and the set of writes that produced it from the previous
+// version. Transactions hold a reference to the version they started from and
+// check the writes of all newer versions for conflicts before committing.
 type data struct {
+	tree     *node
 	contents map[string]*string
+	version  uint64
 	refcount int
 	inner    *data
 }
 
-func (d data) get(key string) *string {
-	v, ok := d.contents[key]
-	if ok {
-		return v
-	}
-
-	if d.inner == nil {
-		return nil
-	}
-
-	return d.inner.get(key)
-}
-
-func (d data) getRange(r keyRange) map[string]*string {
-	m := make(map[string]*string)
-	d.getRangeInto(r, m)
-	return m
-}
-
-func (d data) getRangeInto(r keyRange, m map[string]*string) {
-	if d.inner != nil {
-		d.inner.getRangeInto(r, m)
-	}
-
-	for k, v := range d.contents {
-		if k < r.low || (r.high != "" && k >= r.high) {
-			continue
-		}
-
-		if v == nil {
-			delete(m, k)
-		} else {
-			m[k] = v
-		}
-	}
-}
-
-type locks struct {
-	keys   []string
-	ranges []keyRange
-}
-
-func (l locks) conflicts(d map[string]*string) bool {
-	for _, k := range l.keys {
-		_, found := d[k]
-		if found {
+// conflicts reports whether any key written in d is covered by the locks.
+func conflicts(locks watch.Index, d map[string]*string) bool {
+	for k := range d {
+		if locks.Contains(k) {
 			return true
 		}
 	}
 
-	for _, r := range l.ranges {
-		for k := range d {
-			if k >= r.low && (r.high == "" || k < r.high) {
-				return true
-			}
-		}
-	}
-
 	return false
 }
@@ -1,30 +1,105 @@
 package ram
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/gate"
+	"github.com/encryptio/kvl/backend/internal/watch"
 )
 
 type DB struct {
+	nextTxID uint64 // atomic; first for alignment
+
 	mu       sync.RWMutex
 	headData *data
-	watches  []*watcher
+	log      *wal // nil if not durable
+	watches  *watch.Registry
+	gate     gate.Gate
+	limits   kvl.Limits
+
+	subscriptions map[*Subscription]struct{}
 }
 
 func New() kvl.DB {
 	return &DB{
-		headData: &data{make(map[string]*string, 0), 0, nil},
+		headData: &data{},
+		watches:  watch.NewRegistry(),
 	}
 }
 
+// Close is Shutdown with a timeout of kvl.CloseTimeout.
 func (db *DB) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), kvl.CloseTimeout)
+	defer cancel()
+	db.Shutdown(ctx)
+}
+
+// Shutdown closes the DB as described by kvl.ShutdownDB. Subscriptions are
+// closed without an error.
+func (db *DB) Shutdown(ctx context.Context) error {
+	err := db.gate.Close()
+	if err != nil {
+		return err
+	}
+	db.watches.Close(kvl.ErrClosed)
+
+	err = db.gate.Wait(ctx)
+
+	db.mu.Lock()
+	for s := range db.subscriptions {
+		db.unsubscribeLocked(s, nil)
+	}
+	db.mu.Unlock()
+
+	if db.log != nil {
+		db.log.close()
+	}
+
+	return err
+}
+
+// Ping returns kvl.ErrClosed if the DB is closed.
+func (db *DB) Ping() error {
+	if db.gate.Closed() {
+		return kvl.ErrClosed
+	}
+	return nil
+}
+
+// Stats counts the keys and bytes in the DB exactly, in time proportional to
+// the number of keys.
+func (db *DB) Stats() kvl.Stats {
+	db.mu.Lock()
+	tree := db.headData.tree
+	db.mu.Unlock()
+
+	stats := kvl.Stats{
+		Transactions: db.gate.Active(),
+		Watches:      db.watches.Len(),
+	}
+	tree.ascend("", "", func(k, v string) bool {
+		stats.Keys++
+		stats.Bytes += int64(len(k) + len(v))
+		return true
+	})
+	return stats
 }
 
 func (db *DB) RunTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	info := db.newTxInfo(false)
 	for {
-		err, _, again := db.tryTx(tx, false, false)
+		info.Attempt++
+		err, _, again := db.tryTx(tx, info, false)
 		if !again {
 			return err
 		}
@@ -32,8 +107,16 @@ func (db *DB) RunTx(tx kvl.Tx) error {
 }
 
 func (db *DB) RunReadTx(tx kvl.Tx) error {
+	err := db.gate.Enter()
+	if err != nil {
+		return err
+	}
+	defer db.gate.Leave()
+
+	info := db.newTxInfo(true)
 	for {
-		err, _, again := db.tryTx(tx, true, false)
+		info.Attempt++
+		err, _, again := db.tryTx(tx, info, false)
 		if !again {
 			return err
 		}
@@ -41,15 +124,40 @@ func (db *DB) RunReadTx(tx kvl.Tx) error {
 }
 
 func (db *DB) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return nil, err
+	}
+	defer db.gate.Leave()
+
+	info := db.newTxInfo(true)
 	for {
-		err, wr, again := db.tryTx(tx, true, true)
+		info.Attempt++
+		err, wr, again := db.tryTx(tx, info, true)
 		if !again {
 			return wr, err
 		}
 	}
 }
 
-func (db *DB) tryTx(tx kvl.Tx, readonly bool, setupWatch bool) (error, kvl.WatchResult, bool) {
+func (db *DB) Capabilities() kvl.Capabilities {
+	return kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+		Snapshot:    true,
+		Durable:     db.log != nil,
+	}
+}
+
+func (db *DB) newTxInfo(readonly bool) kvl.TxInfo {
+	return kvl.TxInfo{
+		ID:       atomic.AddUint64(&db.nextTxID, 1),
+		ReadOnly: readonly,
+		Start:    time.Now(),
+	}
+}
+
+func (db *DB) tryTx(tx kvl.Tx, info kvl.TxInfo, setupWatch bool) (error, kvl.WatchResult, bool) {
 	var wr kvl.WatchResult
 
 	db.mu.Lock()
@@ -57,7 +165,7 @@ func (db *DB) tryTx(tx kvl.Tx, readonly bool, setupWatch bool) (error, kvl.Watch
 	myData.refcount++
 	db.mu.Unlock()
 
-	ctx := newCtx(myData, &db.mu, readonly)
+	ctx := newCtx(myData, info, db.limits)
 	err := tx(ctx)
 
 	db.mu.Lock()
@@ -67,14 +175,14 @@ func (db *DB) tryTx(tx kvl.Tx, readonly bool, setupWatch bool) (error, kvl.Watch
 		// see if anything we depend on has changed
 		conflicting := false
 
-		newData := db.headData
-		for newData != myData {
-			if ctx.locks.conflicts(newData.contents) {
-				conflicting = true
-				break
+		if db.headData != myData {
+			locks := ctx.locks.Index()
+			for newData := db.headData; newData != myData; newData = newData.inner {
+				if conflicts(locks, newData.contents) {
+					conflicting = true
+					break
+				}
 			}
-
-			newData = newData.inner
 		}
 
 		if conflicting {
@@ -83,21 +191,18 @@ func (db *DB) tryTx(tx kvl.Tx, readonly bool, setupWatch bool) (error, kvl.Watch
 			// commit!
 
 			if len(ctx.toCommit) > 0 {
-				db.headData = &data{ctx.toCommit, 0, db.headData}
-
-				for i := 0; i < len(db.watches); i++ {
-					if db.watches[i].locks.conflicts(ctx.toCommit) {
-						db.watches[i].trigger()
-						db.watches = append(db.watches[:i], db.watches[i+1:]...)
-						i--
-					}
+				// if nothing else has committed since we started, the ctx's
+				// own tree already holds the new contents
+				tree := ctx.tree
+				if myData != db.headData {
+					tree = db.headData.tree.apply(ctx.toCommit)
 				}
+
+				err = db.commitLocked(ctx.toCommit, tree)
 			}
 
-			if setupWatch {
-				watcher := db.newWatcher(ctx.locks)
-				db.watches = append(db.watches, watcher)
-				wr = watcher
+			if err == nil && setupWatch {
+				wr = db.watches.Watch(ctx.locks)
 			}
 		}
 	}
@@ -116,63 +221,51 @@ func (db *DB) tryTx(tx kvl.Tx, readonly bool, setupWatch bool) (error, kvl.Watch
 	return err, wr, ctx.aborted
 }
 
-func (db *DB) removeWatcher(w *watcher) {
-	db.mu.Lock()
-	for i := 0; i < len(db.watches); i++ {
-		if db.watches[i] == w {
-			db.watches = append(db.watches[:i], db.watches[i+1:]...)
-			i--
-		}
-	}
-	db.mu.Unlock()
-}
-
-func (db *DB) tryMerge() {
+// commitLocked makes tree, the result of applying toCommit to the current
+// head, the new head of the database.
+func (db *DB) commitLocked(toCommit map[string]*string, tree *node) error {
 	// assumes mu.Lock is held
-	for db.tryMergeOne() {
-	}
-}
+	version := db.headData.version + 1
 
-func (db *DB) tryMergeOne() bool {
-	// assumes mu.Lock is held
-
-	if db.headData == nil {
-		return false
-	}
-	if db.headData.inner == nil {
-		return false
+	if db.log != nil {
+		err := db.log.append(version, toCommit)
+		if err != nil {
+			return err
+		}
 	}
 
-	// go to the last two links in the chain
-	second := db.headData
-	last := second.inner
-	for last.inner != nil {
-		last = last.inner
-		second = second.inner
+	db.headData = &data{
+		tree:     tree,
+		contents: toCommit,
+		version:  version,
+		inner:    db.headData,
 	}
 
-	if last.refcount != 0 || second.refcount != 0 {
-		// one of them is in use, can't change them
-		return false
+	written := make([]string, 0, len(toCommit))
+	for k := range toCommit {
+		written = append(written, k)
 	}
+	db.watches.Trigger(written, version)
+	db.publishLocked(toCommit, version)
 
-	// merge last into second
-	for k, v := range last.contents {
-		_, found := second.contents[k]
-		if !found {
-			second.contents[k] = v
-		}
+	if db.log != nil {
+		db.log.maybeSnapshot(tree, version)
 	}
 
-	// remove last from the chain
-	second.inner = nil
+	return nil
+}
 
-	// clean out any deletions from second, they cannot mask anything anymore
-	for k, v := range second.contents {
-		if v == nil {
-			delete(second.contents, k)
+func (db *DB) tryMerge() {
+	// assumes mu.Lock is held
+
+	// Versions older than the oldest one in use by a transaction are not
+	// needed for conflict checks, since every transaction only checks the
+	// versions newer than the one it started from.
+	oldest := db.headData
+	for d := db.headData; d != nil; d = d.inner {
+		if d.refcount > 0 {
+			oldest = d
 		}
 	}
-
-	return true
+	oldest.inner = nil
 }
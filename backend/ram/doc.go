@@ -1,6 +1,7 @@
 // The ram backend is a testing implementation of an SSI kvl.DB.
 //
-// It is not fast (especially in the case of range queries), but it is correct
-// and can be used to test correctness of any other backend that should
-// implement serializable snapshot isolation.
+// The contents of the database are kept in a persistent (copy-on-write) treap,
+// so every transaction reads from an immutable snapshot and range queries take
+// O(log n + k) time. It is correct and can be used to test correctness of any
+// other backend that should implement serializable snapshot isolation.
 package ram
@@ -0,0 +1,139 @@
+package ram
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/urlopt"
+)
+
+func init() {
+	kvl.Register(kvl.Backend{
+		Name:        "ram",
+		Description: "in memory; DSN is empty, or a directory to make it durable",
+		Open: func(dsn string) (kvl.DB, error) {
+			if dsn == "" {
+				return New(), nil
+			}
+			return Open(dsn)
+		},
+		OpenURL: openURL,
+	})
+}
+
+// openURL opens ram: or ram:// as a new in-memory DB, and URLs with a path
+// like ram:///var/lib/db or ram:rel/dir as durable DBs, with the query
+// parameters nosync and snapshot_bytes, and the limits read by
+// urlopt.Parser.Limits.
+func openURL(u *url.URL) (kvl.DB, error) {
+	var opts Options
+	p := urlopt.New(u)
+	p.Bool("nosync", &opts.NoSync)
+	p.Int64("snapshot_bytes", &opts.SnapshotBytes)
+	p.Limits(&opts.Limits)
+	err := p.Done()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenOptions(urlopt.Path(u), &opts)
+}
+
+// Options configures a ram DB.
+type Options struct {
+	// Limits bounds the writes of each transaction.
+	Limits kvl.Limits
+
+	// NoSync disables the fsync after each commit is written to the log. A
+	// crash may then lose recently committed transactions, but never leaves
+	// the database inconsistent.
+	NoSync bool
+
+	// SnapshotBytes is the size the write-ahead log may reach before a
+	// compacted snapshot is written and the log is restarted. Zero means
+	// 16MiB.
+	SnapshotBytes int64
+}
+
+// Open returns a durable DB stored in the given directory, creating it if
+// needed. See OpenOptions.
+func Open(dir string) (kvl.DB, error) {
+	return OpenOptions(dir, nil)
+}
+
+// OpenOptions returns a durable DB stored in the given directory, creating it
+// if needed.
+//
+// A durable DB behaves exactly like one returned by New, but every commit is
+// appended to a checksummed write-ahead log before it becomes visible, and the
+// contents are recovered from the last snapshot and the log when the directory
+// is opened again. Watches are not persisted.
+//
+// Only one DB may have a directory open at a time.
+//
+// If dir is empty, the DB is kept in memory only, like one returned by New.
+func OpenOptions(dir string, opts *Options) (kvl.DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if dir == "" {
+		db := New().(*DB)
+		db.limits = opts.Limits
+		return db, nil
+	}
+
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, version, err := readSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	walVersions, err := listWALs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range walVersions {
+		last := i == len(walVersions)-1
+		tree, version, err = replayWAL(filepath.Join(dir, walName(v)), tree, version, last)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// keep appending to the newest log file, if there is one
+	logVersion := version + 1
+	if len(walVersions) > 0 {
+		logVersion = walVersions[len(walVersions)-1]
+	}
+	f, size, err := openWALFile(dir, logVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotBytes := opts.SnapshotBytes
+	if snapshotBytes <= 0 {
+		snapshotBytes = defaultSnapshotBytes
+	}
+
+	db := New().(*DB)
+	db.limits = opts.Limits
+	db.headData.tree = tree
+	db.headData.version = version
+	db.log = &wal{
+		dir:           dir,
+		noSync:        opts.NoSync,
+		snapshotBytes: snapshotBytes,
+		f:             f,
+		size:          size,
+	}
+
+	return db, nil
+}
@@ -0,0 +1,116 @@
+package ram
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrSubscriptionOverflow is returned by Subscription.Err when the subscriber
+// did not receive commits fast enough and its buffer filled up.
+var ErrSubscriptionOverflow = errors.New("subscriber fell behind the commit stream")
+
+// A Change is a single key written by a commit.
+type Change struct {
+	Key, Value []byte
+	Deleted    bool
+}
+
+// A Commit is the set of keys written by one committed transaction, in
+// ascending key order, and the version of the database it created. The
+// Changes are shared between subscribers and must not be modified.
+type Commit struct {
+	Version uint64
+	Changes []Change
+}
+
+// A Subscription delivers every commit made to a DB after it was created.
+type Subscription struct {
+	db  *DB
+	c   chan Commit
+	err error // protected by db.mu
+}
+
+// Subscribe returns a Subscription receiving every commit made to the DB from
+// now on, including Restores. Nothing is persisted; this is an in-process
+// stream for consumers that don't need a durable change log.
+//
+// Commits are never blocked by a subscriber. If more than buffer commits are
+// waiting to be received, the subscription's channel is closed and Err
+// returns ErrSubscriptionOverflow.
+func (db *DB) Subscribe(buffer int) *Subscription {
+	s := &Subscription{
+		db: db,
+		c:  make(chan Commit, buffer),
+	}
+
+	db.mu.Lock()
+	if db.subscriptions == nil {
+		db.subscriptions = make(map[*Subscription]struct{})
+	}
+	db.subscriptions[s] = struct{}{}
+	db.mu.Unlock()
+
+	return s
+}
+
+// Commits returns the channel the commits are delivered on. It is closed when
+// the Subscription or the DB is closed, or when the subscriber falls behind.
+func (s *Subscription) Commits() <-chan Commit {
+	return s.c
+}
+
+// Err returns ErrSubscriptionOverflow if the channel was closed because the
+// subscriber fell behind, or nil otherwise.
+func (s *Subscription) Err() error {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	return s.err
+}
+
+// Close stops the delivery of commits and closes the channel.
+func (s *Subscription) Close() {
+	s.db.mu.Lock()
+	s.db.unsubscribeLocked(s, nil)
+	s.db.mu.Unlock()
+}
+
+func (db *DB) unsubscribeLocked(s *Subscription, err error) {
+	// assumes mu.Lock is held
+	if _, ok := db.subscriptions[s]; !ok {
+		return
+	}
+	delete(db.subscriptions, s)
+	s.err = err
+	close(s.c)
+}
+
+// publishLocked sends a commit to all subscriptions.
+func (db *DB) publishLocked(toCommit map[string]*string, version uint64) {
+	// assumes mu.Lock is held
+	if len(db.subscriptions) == 0 {
+		return
+	}
+
+	changes := make([]Change, 0, len(toCommit))
+	for k, v := range toCommit {
+		c := Change{Key: []byte(k)}
+		if v == nil {
+			c.Deleted = true
+		} else {
+			c.Value = []byte(*v)
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return string(changes[i].Key) < string(changes[j].Key)
+	})
+
+	commit := Commit{Version: version, Changes: changes}
+	for s := range db.subscriptions {
+		select {
+		case s.c <- commit:
+		default:
+			db.unsubscribeLocked(s, ErrSubscriptionOverflow)
+		}
+	}
+}
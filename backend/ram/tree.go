@@ -0,0 +1,251 @@
+package ram
+
+// node is a node in a persistent treap mapping keys to values.
+//
+// Nodes are never modified once they are reachable from a committed tree;
+// every modification copies the path from the root to the changed node, so
+// any *node may be held as an immutable snapshot of the whole tree.
+//
+// Node priorities are derived from a hash of the key, so the shape of a tree
+// depends only on the set of keys it contains.
+type node struct {
+	key, value  string
+	priority    uint32
+	left, right *node
+}
+
+// keyPriority returns the FNV-1a hash of the key.
+func keyPriority(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (n *node) get(key string) *string {
+	for n != nil {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return &n.value
+		}
+	}
+	return nil
+}
+
+// set returns a tree with key set to value.
+func (n *node) set(key, value string) *node {
+	return n.insert(key, value, keyPriority(key))
+}
+
+func (n *node) insert(key, value string, priority uint32) *node {
+	if n == nil {
+		return &node{key: key, value: value, priority: priority}
+	}
+
+	c := *n
+	switch {
+	case key < n.key:
+		c.left = n.left.insert(key, value, priority)
+		if c.left.priority > c.priority {
+			// rotate right; c.left is a fresh copy and safe to modify
+			l := c.left
+			c.left = l.right
+			l.right = &c
+			return l
+		}
+	case key > n.key:
+		c.right = n.right.insert(key, value, priority)
+		if c.right.priority > c.priority {
+			// rotate left
+			r := c.right
+			c.right = r.left
+			r.left = &c
+			return r
+		}
+	default:
+		c.value = value
+	}
+	return &c
+}
+
+// delete returns a tree without the given key. If the key is not present, n
+// itself is returned.
+func (n *node) delete(key string) *node {
+	if n == nil {
+		return nil
+	}
+
+	switch {
+	case key < n.key:
+		left := n.left.delete(key)
+		if left == n.left {
+			return n
+		}
+		c := *n
+		c.left = left
+		return &c
+	case key > n.key:
+		right := n.right.delete(key)
+		if right == n.right {
+			return n
+		}
+		c := *n
+		c.right = right
+		return &c
+	default:
+		return join(n.left, n.right)
+	}
+}
+
+// join returns a tree containing the keys of both l and r. All keys in l must
+// be less than all keys in r.
+func join(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+
+	if l.priority > r.priority {
+		c := *l
+		c.right = join(l.right, r)
+		return &c
+	}
+
+	c := *r
+	c.left = join(l, r.left)
+	return &c
+}
+
+// apply returns a tree with all the changes in m applied. nil values in m are
+// deletions.
+func (n *node) apply(m map[string]*string) *node {
+	for k, v := range m {
+		if v == nil {
+			n = n.delete(k)
+		} else {
+			n = n.set(k, *v)
+		}
+	}
+	return n
+}
+
+// ascend calls fn on each key/value pair in [low, high) in ascending order,
+// stopping early if fn returns false. An empty high is treated as unbounded.
+//
+// The return value is false if the iteration was stopped early.
+func (n *node) ascend(low, high string, fn func(k, v string) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	if low <= n.key {
+		if !n.left.ascend(low, high, fn) {
+			return false
+		}
+	}
+	if high != "" && n.key >= high {
+		return false
+	}
+	if n.key >= low {
+		if !fn(n.key, n.value) {
+			return false
+		}
+	}
+	return n.right.ascend(low, high, fn)
+}
+
+// descend is like ascend, but visits the pairs in descending order.
+func (n *node) descend(low, high string, fn func(k, v string) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	inHigh := high == "" || n.key < high
+	if inHigh {
+		if !n.right.descend(low, high, fn) {
+			return false
+		}
+	}
+	if n.key < low {
+		return false
+	}
+	if inHigh {
+		if !fn(n.key, n.value) {
+			return false
+		}
+	}
+	return n.left.descend(low, high, fn)
+}
+
+// split returns the trees holding the keys of n less than and greater than
+// key, and a pointer to the value of key if it is present. Subtrees not on the
+// path to key are shared with n.
+func (n *node) split(key string) (*node, *string, *node) {
+	if n == nil {
+		return nil, nil, nil
+	}
+
+	switch {
+	case key < n.key:
+		l, v, r := n.left.split(key)
+		if r == n.left {
+			return l, v, n
+		}
+		c := *n
+		c.left = r
+		return l, v, &c
+	case key > n.key:
+		l, v, r := n.right.split(key)
+		if l == n.right {
+			return n, v, r
+		}
+		c := *n
+		c.right = l
+		return &c, v, r
+	default:
+		return n.left, &n.value, n.right
+	}
+}
+
+// diffTrees calls fn for every key whose value in b differs from its value in
+// a, passing the value in b (nil if the key is not in b.)
+//
+// Subtrees shared between a and b are skipped, so diffing two versions of a
+// tree usually takes time proportional to the number of differences (times
+// log n) rather than to the size of the trees.
+func diffTrees(a, b *node, fn func(key string, value *string)) {
+	if a == b {
+		return
+	}
+	if a == nil {
+		b.ascend("", "", func(k, v string) bool {
+			fn(k, &v)
+			return true
+		})
+		return
+	}
+	if b == nil {
+		a.ascend("", "", func(k, v string) bool {
+			fn(k, nil)
+			return true
+		})
+		return
+	}
+
+	bl, bv, br := b.split(a.key)
+	diffTrees(a.left, bl, fn)
+	if bv == nil {
+		fn(a.key, nil)
+	} else if *bv != a.value {
+		fn(a.key, bv)
+	}
+	diffTrees(a.right, br, fn)
+}
@@ -0,0 +1,143 @@
+package ram
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func collectTree(n *node, low, high string, limit int, descending bool) []string {
+	var got []string
+	fn := func(k, v string) bool {
+		if k != v {
+			panic("value mismatch")
+		}
+		got = append(got, k)
+		return limit <= 0 || len(got) < limit
+	}
+	if descending {
+		n.descend(low, high, fn)
+	} else {
+		n.ascend(low, high, fn)
+	}
+	return got
+}
+
+func collectMap(m map[string]bool, low, high string, limit int, descending bool) []string {
+	var want []string
+	for k := range m {
+		if k >= low && (high == "" || k < high) {
+			want = append(want, k)
+		}
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.StringSlice(want)))
+	} else {
+		sort.Strings(want)
+	}
+	if limit > 0 && len(want) > limit {
+		want = want[:limit]
+	}
+	return want
+}
+
+func TestTreeRandomOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randKey := func() string {
+		return strconv.Itoa(r.Intn(500))
+	}
+
+	var tree *node
+	m := make(map[string]bool)
+	var snapshots []*node
+	var snapshotMaps []map[string]bool
+
+	for i := 0; i < 5000; i++ {
+		k := randKey()
+		if r.Intn(3) == 0 {
+			tree = tree.delete(k)
+			delete(m, k)
+		} else {
+			tree = tree.set(k, k)
+			m[k] = true
+		}
+
+		if i%500 == 0 {
+			snap := make(map[string]bool, len(m))
+			for k := range m {
+				snap[k] = true
+			}
+			snapshots = append(snapshots, tree)
+			snapshotMaps = append(snapshotMaps, snap)
+		}
+
+		if i%50 == 0 {
+			low, high := randKey(), randKey()
+			if r.Intn(4) == 0 {
+				high = ""
+			}
+			limit := r.Intn(10)
+			descending := r.Intn(2) == 0
+
+			got := collectTree(tree, low, high, limit, descending)
+			want := collectMap(m, low, high, limit, descending)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("range(%q, %q, %v, %v) = %v, wanted %v",
+					low, high, limit, descending, got, want)
+			}
+		}
+	}
+
+	for i, snap := range snapshots {
+		got := collectTree(snap, "", "", 0, false)
+		want := collectMap(snapshotMaps[i], "", "", 0, false)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("snapshot %v was modified: got %v, wanted %v", i, got, want)
+		}
+	}
+}
+
+func TestDiffTrees(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	var a *node
+	for i := 0; i < 300; i++ {
+		k := strconv.Itoa(r.Intn(1000))
+		a = a.set(k, k)
+	}
+
+	for i := 0; i < 200; i++ {
+		b := a
+		want := make(map[string]*string)
+		for j := r.Intn(20); j > 0; j-- {
+			k := strconv.Itoa(r.Intn(1000))
+			if r.Intn(2) == 0 {
+				b = b.delete(k)
+			} else {
+				b = b.set(k, strconv.Itoa(r.Intn(3)))
+			}
+		}
+		b.ascend("", "", func(k, v string) bool {
+			if av := a.get(k); av == nil || *av != v {
+				want[k] = &v
+			}
+			return true
+		})
+		a.ascend("", "", func(k, v string) bool {
+			if b.get(k) == nil {
+				want[k] = nil
+			}
+			return true
+		})
+
+		got := make(map[string]*string)
+		diffTrees(a, b, func(k string, v *string) {
+			got[k] = v
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("diffTrees got %v, wanted %v", got, want)
+		}
+	}
+}
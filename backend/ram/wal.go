@@ -0,0 +1,493 @@
+package ram
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// On disk, a durable ram database is a directory holding a snapshot of the
+// contents at some version and write-ahead log files holding the writes of
+// every commit after it.
+//
+// Both kinds of files are a magic header followed by a sequence of records:
+//
+//     uint32 payload length (big endian)
+//     uint32 CRC-32C of payload (big endian)
+//     payload:
+//         uvarint version
+//         uvarint number of entries
+//         entries:
+//             uvarint key length, key
+//             byte 0 for a deletion, 1 for a set
+//             if set: uvarint value length, value
+//
+// A log file holds one record per commit, and is named after the version of
+// its first record. A snapshot holds records whose versions are all the
+// version of the snapshot, and ends with a record with no entries.
+
+const (
+	snapshotName     = "snapshot"
+	snapshotTempName = "snapshot.tmp"
+	walPrefix        = "wal."
+
+	walMagic      = "kvlwal01"
+	snapshotMagic = "kvlsnp01"
+
+	snapshotChunkSize    = 4096
+	defaultSnapshotBytes = 16 * 1024 * 1024
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errCorruptRecord = errors.New("corrupt record")
+	errLogClosed     = errors.New("ram: database is closed")
+)
+
+type entry struct {
+	key   string
+	value *string
+}
+
+func appendRecord(buf []byte, version uint64, entries []entry) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	buf = binary.AppendUvarint(buf, version)
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, uint64(len(e.key)))
+		buf = append(buf, e.key...)
+		if e.value == nil {
+			buf = append(buf, 0)
+		} else {
+			buf = append(buf, 1)
+			buf = binary.AppendUvarint(buf, uint64(len(*e.value)))
+			buf = append(buf, *e.value...)
+		}
+	}
+
+	payload := buf[start+8:]
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[start+4:], crc32.Checksum(payload, crcTable))
+	return buf
+}
+
+// readRecord parses the record at the start of buf, returning its contents
+// and the number of bytes it used.
+func readRecord(buf []byte) (uint64, []entry, int, error) {
+	if len(buf) < 8 {
+		return 0, nil, 0, errCorruptRecord
+	}
+	length := binary.BigEndian.Uint32(buf)
+	sum := binary.BigEndian.Uint32(buf[4:])
+	if uint64(len(buf)-8) < uint64(length) {
+		return 0, nil, 0, errCorruptRecord
+	}
+	payload := buf[8 : 8+length]
+	if crc32.Checksum(payload, crcTable) != sum {
+		return 0, nil, 0, errCorruptRecord
+	}
+
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return 0, errCorruptRecord
+		}
+		payload = payload[n:]
+		return v, nil
+	}
+	readString := func() (string, error) {
+		l, err := readUvarint()
+		if err != nil {
+			return "", err
+		}
+		if uint64(len(payload)) < l {
+			return "", errCorruptRecord
+		}
+		s := string(payload[:l])
+		payload = payload[l:]
+		return s, nil
+	}
+
+	version, err := readUvarint()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	count, err := readUvarint()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if count > uint64(len(payload)) {
+		return 0, nil, 0, errCorruptRecord
+	}
+
+	entries := make([]entry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var e entry
+		e.key, err = readString()
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		if len(payload) == 0 {
+			return 0, nil, 0, errCorruptRecord
+		}
+		op := payload[0]
+		payload = payload[1:]
+		switch op {
+		case 0:
+		case 1:
+			v, err := readString()
+			if err != nil {
+				return 0, nil, 0, err
+			}
+			e.value = &v
+		default:
+			return 0, nil, 0, errCorruptRecord
+		}
+		entries = append(entries, e)
+	}
+	if len(payload) != 0 {
+		return 0, nil, 0, errCorruptRecord
+	}
+
+	return version, entries, 8 + int(length), nil
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func walName(version uint64) string {
+	return fmt.Sprintf("%v%016x", walPrefix, version)
+}
+
+// listWALs returns the start versions of the log files in dir, in order.
+func listWALs(dir string) ([]uint64, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []uint64
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, walPrefix) {
+			continue
+		}
+		v, err := strconv.ParseUint(name[len(walPrefix):], 16, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Sort(uint64s(versions))
+	return versions, nil
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+
+// readSnapshot loads the snapshot in dir, if any.
+func readSnapshot(dir string) (*node, uint64, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, snapshotName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	if !strings.HasPrefix(string(buf), snapshotMagic) {
+		return nil, 0, fmt.Errorf("ram: %v is not a snapshot file", snapshotName)
+	}
+	buf = buf[len(snapshotMagic):]
+
+	var tree *node
+	var snapVersion uint64
+	for first := true; ; first = false {
+		version, entries, n, err := readRecord(buf)
+		if err != nil {
+			return nil, 0, fmt.Errorf("ram: %v: %v", snapshotName, err)
+		}
+		buf = buf[n:]
+
+		if first {
+			snapVersion = version
+		} else if version != snapVersion {
+			return nil, 0, fmt.Errorf("ram: %v: mismatched versions", snapshotName)
+		}
+
+		if len(entries) == 0 {
+			break
+		}
+		for _, e := range entries {
+			if e.value != nil {
+				tree = tree.set(e.key, *e.value)
+			}
+		}
+	}
+
+	if len(buf) != 0 {
+		return nil, 0, fmt.Errorf("ram: %v: trailing data", snapshotName)
+	}
+
+	return tree, snapVersion, nil
+}
+
+// writeSnapshot atomically replaces the snapshot in dir with tree.
+func writeSnapshot(dir string, tree *node, version uint64) error {
+	tmpPath := filepath.Join(dir, snapshotTempName)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	buf := []byte(snapshotMagic)
+	entries := make([]entry, 0, snapshotChunkSize)
+	flush := func() error {
+		buf = appendRecord(buf, version, entries)
+		entries = entries[:0]
+		_, err := f.Write(buf)
+		buf = buf[:0]
+		return err
+	}
+
+	tree.ascend("", "", func(k, v string) bool {
+		entries = append(entries, entry{k, &v})
+		if len(entries) == snapshotChunkSize {
+			err = flush()
+		}
+		return err == nil
+	})
+	if err == nil && len(entries) > 0 {
+		err = flush()
+	}
+	if err == nil {
+		// terminator
+		err = flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(dir, snapshotName))
+	if err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// replayWAL applies the records in a log file to tree, starting after the
+// given version. If truncateTorn is set, a damaged tail of the file (from a
+// crash during a write) is removed; otherwise it is an error.
+func replayWAL(path string, tree *node, version uint64, truncateTorn bool) (*node, uint64, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(buf) < len(walMagic) || !strings.HasPrefix(string(buf), walMagic) {
+		if truncateTorn && strings.HasPrefix(walMagic, string(buf)) {
+			// crashed while creating the file
+			return tree, version, os.Truncate(path, 0)
+		}
+		return nil, 0, fmt.Errorf("ram: %v is not a log file", path)
+	}
+
+	offset := len(walMagic)
+	for offset < len(buf) {
+		recVersion, entries, n, err := readRecord(buf[offset:])
+		if err != nil {
+			if truncateTorn {
+				return tree, version, os.Truncate(path, int64(offset))
+			}
+			return nil, 0, fmt.Errorf("ram: %v at offset %v: %v", path, offset, err)
+		}
+		offset += n
+
+		if recVersion <= version {
+			// already included in the snapshot
+			continue
+		}
+		if recVersion != version+1 {
+			return nil, 0, fmt.Errorf("ram: %v: missing versions %v to %v",
+				path, version+1, recVersion-1)
+		}
+
+		for _, e := range entries {
+			if e.value == nil {
+				tree = tree.delete(e.key)
+			} else {
+				tree = tree.set(e.key, *e.value)
+			}
+		}
+		version = recVersion
+	}
+
+	return tree, version, nil
+}
+
+// wal is the writer for the on-disk state of a durable DB.
+type wal struct {
+	dir           string
+	noSync        bool
+	snapshotBytes int64
+
+	mu           sync.Mutex
+	f            *os.File
+	size         int64
+	err          error // set if the log could not be restored after a failed write
+	snapshotting bool
+	snapshots    sync.WaitGroup
+}
+
+func openWALFile(dir string, version uint64) (*os.File, int64, error) {
+	path := filepath.Join(dir, walName(version))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	size := info.Size()
+
+	if size == 0 {
+		_, err = f.Write([]byte(walMagic))
+		if err == nil {
+			err = f.Sync()
+		}
+		if err == nil {
+			err = syncDir(dir)
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		size = int64(len(walMagic))
+	}
+
+	return f, size, nil
+}
+
+func (w *wal) append(version uint64, toCommit map[string]*string) error {
+	entries := make([]entry, 0, len(toCommit))
+	for k, v := range toCommit {
+		entries = append(entries, entry{k, v})
+	}
+	buf := appendRecord(nil, version, entries)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	if w.f == nil {
+		return errLogClosed
+	}
+
+	_, err := w.f.Write(buf)
+	if err == nil && !w.noSync {
+		err = w.f.Sync()
+	}
+	if err != nil {
+		// Remove any partial record, so later records are not stranded behind
+		// it during recovery.
+		terr := w.f.Truncate(w.size)
+		if terr != nil {
+			w.err = fmt.Errorf("ram: couldn't undo failed log write: %v", terr)
+		}
+		return err
+	}
+
+	w.size += int64(len(buf))
+	return nil
+}
+
+// maybeSnapshot starts writing a snapshot of tree in the background if the
+// log has grown large enough.
+func (w *wal) maybeSnapshot(tree *node, version uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.snapshotting || w.f == nil || w.err != nil || w.size < w.snapshotBytes {
+		return
+	}
+
+	// Records after this version go into a new log file, so the files
+	// before it can be removed once the snapshot is written.
+	f, size, err := openWALFile(w.dir, version+1)
+	if err != nil {
+		// try again on a later commit
+		return
+	}
+	w.f.Close()
+	w.f = f
+	w.size = size
+
+	w.snapshotting = true
+	w.snapshots.Add(1)
+	go w.snapshot(tree, version)
+}
+
+func (w *wal) snapshot(tree *node, version uint64) {
+	defer w.snapshots.Done()
+
+	err := writeSnapshot(w.dir, tree, version)
+	if err == nil {
+		versions, err := listWALs(w.dir)
+		if err == nil {
+			for _, v := range versions {
+				if v <= version {
+					os.Remove(filepath.Join(w.dir, walName(v)))
+				}
+			}
+		}
+	}
+
+	w.mu.Lock()
+	w.snapshotting = false
+	w.mu.Unlock()
+}
+
+func (w *wal) close() {
+	w.snapshots.Wait()
+
+	w.mu.Lock()
+	if w.f != nil {
+		w.f.Close()
+		w.f = nil
+	}
+	w.mu.Unlock()
+}
@@ -0,0 +1,322 @@
+package remote
+
+import (
+	"context"
+	"net/rpc"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/internal/gate"
+	"github.com/encryptio/kvl/backend/internal/urlopt"
+)
+
+func init() {
+	kvl.Register(kvl.Backend{
+		Name:        "remote",
+		Description: "a DB served by a remote.Server; DSN is its host:port",
+		Open: func(addr string) (kvl.DB, error) {
+			return Dial(addr)
+		},
+		OpenURL: func(u *url.URL) (kvl.DB, error) {
+			err := urlopt.New(u).Done()
+			if err != nil {
+				return nil, err
+			}
+			return Dial(u.Host)
+		},
+	})
+}
+
+// DB is a client connection to a Server.
+type DB struct {
+	addr   string
+	client *rpc.Client
+	caps   kvl.Capabilities // of the server's DB
+	gate   gate.Gate
+
+	mu      sync.Mutex
+	watches map[*watchResult]struct{} // not yet fired or closed
+}
+
+// Dial connects to the Server listening on the given TCP address.
+func Dial(addr string) (*DB, error) {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		addr:    addr,
+		client:  client,
+		watches: make(map[*watchResult]struct{}),
+	}
+
+	err = db.call("Capabilities", Empty{}, &db.caps)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Addr returns the address of the server.
+func (db *DB) Addr() string {
+	return db.addr
+}
+
+// Capabilities reports the server DB's support for watches and durability.
+// Several clients may always share a server.
+func (db *DB) Capabilities() kvl.Capabilities {
+	return kvl.Capabilities{
+		Watch:        db.caps.Watch,
+		Durable:      db.caps.Durable,
+		MultiProcess: true,
+	}
+}
+
+func (db *DB) call(method string, args, reply interface{}) error {
+	return decodeError(db.client.Call(serviceName+"."+method, args, reply))
+}
+
+// Close is Shutdown with a timeout of kvl.CloseTimeout.
+func (db *DB) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), kvl.CloseTimeout)
+	defer cancel()
+	db.Shutdown(ctx)
+}
+
+// Shutdown closes the connection as described by kvl.ShutdownDB. The
+// server's DB is left open.
+func (db *DB) Shutdown(ctx context.Context) error {
+	err := db.gate.Close()
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	watches := db.watches
+	db.watches = nil
+	db.mu.Unlock()
+	for w := range watches {
+		w.finish(kvl.ErrClosed)
+	}
+
+	err = db.gate.Wait(ctx)
+	db.client.Close()
+	return err
+}
+
+// Ping returns kvl.ErrClosed if the connection is closed, or the result of
+// kvl.Ping on the server's DB.
+func (db *DB) Ping() error {
+	if db.gate.Closed() {
+		return kvl.ErrClosed
+	}
+	return db.call("Ping", Empty{}, &Empty{})
+}
+
+// Stats returns the Stats of the server's DB, without its Backend field. The
+// counts are unknown if the server can't be reached.
+func (db *DB) Stats() kvl.Stats {
+	var stats kvl.Stats
+	err := db.call("Stats", Empty{}, &stats)
+	if err != nil {
+		return kvl.Stats{Keys: -1, Bytes: -1, Transactions: -1, Watches: -1}
+	}
+	return stats
+}
+
+func (db *DB) RunTx(tx kvl.Tx) error {
+	_, err := db.runTx(tx, modeReadWrite)
+	return err
+}
+
+func (db *DB) RunReadTx(tx kvl.Tx) error {
+	_, err := db.runTx(tx, modeRead)
+	return err
+}
+
+func (db *DB) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	watchID, err := db.runTx(tx, modeWatch)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watchResult{
+		db:   db,
+		id:   watchID,
+		done: make(chan struct{}),
+	}
+
+	db.mu.Lock()
+	if db.watches == nil {
+		db.mu.Unlock()
+		w.finish(kvl.ErrClosed)
+		return w, nil
+	}
+	db.watches[w] = struct{}{}
+	db.mu.Unlock()
+
+	go w.wait()
+	return w, nil
+}
+
+// runTx runs tx as a transaction on the server, running it again whenever
+// the server asks.
+func (db *DB) runTx(tx kvl.Tx, mode txMode) (uint64, error) {
+	err := db.gate.Enter()
+	if err != nil {
+		return 0, err
+	}
+	defer db.gate.Leave()
+
+	start := time.Now()
+	var begin BeginReply
+	err = db.call("Begin", BeginArgs{Mode: mode}, &begin)
+	if err != nil {
+		return 0, err
+	}
+
+	// the server's transaction IDs are unique on this connection
+	info := kvl.TxInfo{
+		ID:       begin.TxID,
+		ReadOnly: mode != modeReadWrite,
+		Start:    start,
+	}
+	for {
+		info.Attempt++
+		c := &ctx{db: db, id: begin.TxID, readonly: info.ReadOnly, info: info}
+		txErr := tx(c)
+
+		var end EndReply
+		err = db.call("End", EndArgs{TxID: begin.TxID, Commit: txErr == nil}, &end)
+		if err != nil {
+			return 0, err
+		}
+
+		if end.Status == endRetry {
+			continue
+		}
+		return end.WatchID, txErr
+	}
+}
+
+type ctx struct {
+	db       *DB
+	id       uint64
+	readonly bool
+	info     kvl.TxInfo
+	size     kvl.TxSize // as of the last successful write
+}
+
+// TxInfo describes the transaction. The version it reads is not known.
+func (c *ctx) TxInfo() kvl.TxInfo {
+	return c.info
+}
+
+// TxSize reports the size of the transaction's writes as counted by the
+// server's DB, which enforces its own limits, if any.
+func (c *ctx) TxSize() kvl.TxSize {
+	return c.size
+}
+
+func (c *ctx) Get(key []byte) (kvl.Pair, error) {
+	var reply PairReply
+	err := c.db.call("Get", KeyArgs{TxID: c.id, Key: key}, &reply)
+	return reply.Pair, err
+}
+
+func (c *ctx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
+	var reply PairsReply
+	err := c.db.call("Range", RangeArgs{TxID: c.id, Query: query}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Pairs == nil {
+		reply.Pairs = []kvl.Pair{}
+	}
+	return reply.Pairs, nil
+}
+
+func (c *ctx) Set(p kvl.Pair) error {
+	if c.readonly {
+		return kvl.ErrReadOnlyTx
+	}
+	var reply WriteReply
+	err := c.db.call("Set", SetArgs{TxID: c.id, Pair: p}, &reply)
+	if err == nil {
+		c.size = reply.Size
+	}
+	return err
+}
+
+func (c *ctx) Delete(key []byte) error {
+	if c.readonly {
+		return kvl.ErrReadOnlyTx
+	}
+	var reply WriteReply
+	err := c.db.call("Delete", KeyArgs{TxID: c.id, Key: key}, &reply)
+	if err == nil {
+		c.size = reply.Size
+	}
+	return err
+}
+
+type watchResult struct {
+	db   *DB
+	id   uint64
+	done chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+func (w *watchResult) wait() {
+	w.finish(w.db.call("WaitWatch", WatchArgs{WatchID: w.id}, &Empty{}))
+}
+
+// finish closes the Done channel with err, if it is not closed yet.
+func (w *watchResult) finish(err error) {
+	w.mu.Lock()
+	if !w.closed {
+		w.err = err
+		w.closed = true
+		close(w.done)
+	}
+	w.mu.Unlock()
+
+	w.db.removeWatch(w)
+}
+
+func (w *watchResult) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *watchResult) Error() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *watchResult) Close() {
+	w.mu.Lock()
+	wasClosed := w.closed
+	if !wasClosed {
+		w.closed = true
+		close(w.done)
+	}
+	w.mu.Unlock()
+	w.db.removeWatch(w)
+
+	// the server's watch is released even if it already fired
+	w.db.client.Go(serviceName+".CloseWatch", WatchArgs{WatchID: w.id}, &Empty{}, nil)
+}
+
+func (db *DB) removeWatch(w *watchResult) {
+	db.mu.Lock()
+	delete(db.watches, w)
+	db.mu.Unlock()
+}
@@ -0,0 +1,16 @@
+// The remote backend lets several processes share one kvl.DB over the network.
+//
+// A Server serves any kvl.DB; the client DB returned by Dial (or by kvl.Open
+// with the backend name "remote" and the server's address as the DSN) sends
+// every operation of a transaction to the server, which runs the transaction
+// on its DB. Conflicts detected by the server's DB cause the client's Tx to be
+// run again, exactly as they would locally. Watches are supported if the
+// server's DB supports them.
+//
+// A transaction runs on the server until its client ends it. Set
+// Server.IdleTimeout to roll back the transactions of clients that stop
+// sending operations.
+//
+// The protocol is net/rpc with gob encoding. It has no authentication or
+// encryption; only serve it on trusted networks.
+package remote
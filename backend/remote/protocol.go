@@ -0,0 +1,124 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/encryptio/kvl"
+)
+
+const serviceName = "KVL"
+
+// txMode is the kind of transaction started by Begin.
+type txMode int
+
+const (
+	modeReadWrite txMode = iota
+	modeRead
+	modeWatch
+)
+
+type BeginArgs struct {
+	Mode txMode
+}
+
+type BeginReply struct {
+	TxID uint64
+}
+
+type KeyArgs struct {
+	TxID uint64
+	Key  []byte
+}
+
+type RangeArgs struct {
+	TxID  uint64
+	Query kvl.RangeQuery
+}
+
+type SetArgs struct {
+	TxID uint64
+	Pair kvl.Pair
+}
+
+type PairReply struct {
+	Pair kvl.Pair
+}
+
+// WriteReply is the reply to Set and Delete: the size of the transaction's
+// writes so far, as counted by the server's Ctx.
+type WriteReply struct {
+	Size kvl.TxSize
+}
+
+type PairsReply struct {
+	Pairs []kvl.Pair
+}
+
+type EndArgs struct {
+	TxID   uint64
+	Commit bool
+}
+
+// endStatus is the outcome of a transaction attempt.
+type endStatus int
+
+const (
+	endDone  endStatus = iota // committed, or rolled back with the Tx's error
+	endRetry                  // the server's DB wants to run the Tx again
+)
+
+type EndReply struct {
+	Status  endStatus
+	WatchID uint64 // set for watch transactions that succeeded
+}
+
+type WatchArgs struct {
+	WatchID uint64
+}
+
+type Empty struct{}
+
+var (
+	// errTxAborted ends a server transaction whose client Tx returned an
+	// error; the client reports its own error instead.
+	errTxAborted = errors.New("remote: transaction aborted by client")
+
+	errUnknownTx    = errors.New("remote: unknown transaction")
+	errUnknownWatch = errors.New("remote: unknown watch")
+	errClientGone   = errors.New("remote: client disconnected")
+	errTxIdle       = errors.New("remote: transaction rolled back after idle timeout")
+)
+
+// knownErrors are the errors that keep their identity across the network.
+// Other errors are reported to the client with their messages only.
+var knownErrors = []error{
+	kvl.ErrNotFound,
+	kvl.ErrReadOnlyTx,
+	kvl.ErrWatchUnsupported,
+	kvl.ErrClosed,
+	errUnknownTx,
+	errUnknownWatch,
+}
+
+// decodeError converts an error returned by an RPC back into a known error if
+// it was one. A *kvl.TransactionTooLargeError is rebuilt from its message.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, known := range knownErrors {
+		if err.Error() == known.Error() {
+			return known
+		}
+	}
+
+	var tooLarge kvl.TransactionTooLargeError
+	_, scanErr := fmt.Sscanf(err.Error(), "transaction too large: %s is %d, would be %d",
+		&tooLarge.Limit, &tooLarge.Max, &tooLarge.Size)
+	if scanErr == nil && tooLarge.Error() == err.Error() {
+		return &tooLarge
+	}
+
+	return err
+}
@@ -0,0 +1,387 @@
+package remote
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/encryptio/kvl"
+)
+
+// A Server serves a kvl.DB to remote clients.
+type Server struct {
+	// IdleTimeout, if positive, is how long a transaction waits for its
+	// client's next operation. A transaction left idle for longer is rolled
+	// back, and the client's later operations on it fail. Set it before
+	// serving any connections.
+	IdleTimeout time.Duration
+
+	db kvl.DB
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[io.Closer]struct{}
+	closed    bool
+}
+
+// NewServer returns a Server serving db. The db is not closed by the Server.
+func NewServer(db kvl.DB) *Server {
+	return &Server{
+		db:        db,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[io.Closer]struct{}),
+	}
+}
+
+// Serve accepts connections on l and serves each one in its own goroutine. It
+// returns when l fails to accept, such as after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection, returning when the client hangs up.
+// The client's open transactions are rolled back and its watches closed.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	sess := &session{
+		db:          s.db,
+		idleTimeout: s.IdleTimeout,
+		txs:         make(map[uint64]*serverTx),
+		watches:     make(map[uint64]kvl.WatchResult),
+		gone:        make(chan struct{}),
+	}
+
+	rs := rpc.NewServer()
+	rs.RegisterName(serviceName, sess)
+	rs.ServeConn(conn)
+
+	sess.close()
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// Close stops all listeners passed to Serve and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return nil
+}
+
+// session is the state of a single client connection. Its exported methods
+// are the RPC methods.
+type session struct {
+	db          kvl.DB
+	idleTimeout time.Duration
+
+	mu      sync.Mutex
+	nextID  uint64
+	txs     map[uint64]*serverTx
+	watches map[uint64]kvl.WatchResult
+
+	gone chan struct{} // closed when the connection ends
+}
+
+// A serverTx is a transaction running on the server's DB on behalf of a
+// client. The Tx passed to the DB receives the client's operations over ops.
+type serverTx struct {
+	ops   chan txOp
+	retry chan struct{} // sent when the DB calls the Tx again
+	done  chan struct{} // closed when the DB returns
+	res   txResult      // set before done is closed
+}
+
+type txOp struct {
+	fn    func(kvl.Ctx) error
+	end   bool // fn is nil; ends the attempt
+	abort bool // with end, the client's Tx returned an error
+	reply chan error
+}
+
+type txResult struct {
+	wr  kvl.WatchResult
+	err error
+}
+
+func (s *session) close() {
+	close(s.gone)
+
+	s.mu.Lock()
+	watches := s.watches
+	s.watches = nil
+	s.mu.Unlock()
+
+	for _, wr := range watches {
+		wr.Close()
+	}
+}
+
+func (s *session) Capabilities(args Empty, reply *kvl.Capabilities) error {
+	*reply = kvl.CapabilitiesOf(s.db)
+	return nil
+}
+
+func (s *session) Ping(args Empty, reply *Empty) error {
+	return kvl.Ping(s.db)
+}
+
+func (s *session) Stats(args Empty, reply *kvl.Stats) error {
+	*reply = kvl.StatsOf(s.db)
+	reply.Backend = nil
+	return nil
+}
+
+func (s *session) Begin(args BeginArgs, reply *BeginReply) error {
+	st := &serverTx{
+		ops:   make(chan txOp),
+		retry: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.txs[id] = st
+	s.mu.Unlock()
+
+	go s.runTx(st, args.Mode)
+
+	reply.TxID = id
+	return nil
+}
+
+func (s *session) runTx(st *serverTx, mode txMode) {
+	attempts := 0
+	tx := func(ctx kvl.Ctx) error {
+		attempts++
+		if attempts > 1 {
+			select {
+			case st.retry <- struct{}{}:
+			case <-s.gone:
+				return errClientGone
+			}
+		}
+
+		for {
+			op, err := s.nextOp(st)
+			if err != nil {
+				return err
+			}
+			if op.end {
+				if op.abort {
+					return errTxAborted
+				}
+				return nil
+			}
+			op.reply <- op.fn(ctx)
+		}
+	}
+
+	switch mode {
+	case modeReadWrite:
+		st.res.err = s.db.RunTx(tx)
+	case modeRead:
+		st.res.err = s.db.RunReadTx(tx)
+	case modeWatch:
+		st.res.wr, st.res.err = s.db.WatchTx(tx)
+	}
+	close(st.done)
+}
+
+// nextOp waits for the client's next operation on st, for no longer than the
+// session's idle timeout.
+func (s *session) nextOp(st *serverTx) (txOp, error) {
+	var idle <-chan time.Time
+	if s.idleTimeout > 0 {
+		timer := time.NewTimer(s.idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	select {
+	case op := <-st.ops:
+		return op, nil
+	case <-idle:
+		return txOp{}, errTxIdle
+	case <-s.gone:
+		return txOp{}, errClientGone
+	}
+}
+
+func (s *session) getTx(id uint64) (*serverTx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.txs[id]
+	if st == nil {
+		return nil, errUnknownTx
+	}
+	return st, nil
+}
+
+// do runs fn on the Ctx of the transaction's current attempt. If the DB
+// returned without running the Tx, as it does once it is closed, its error is
+// returned instead.
+func (s *session) do(id uint64, fn func(kvl.Ctx) error) error {
+	st, err := s.getTx(id)
+	if err != nil {
+		return err
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case st.ops <- txOp{fn: fn, reply: reply}:
+	case <-st.done:
+		return st.res.err
+	case <-s.gone:
+		return errClientGone
+	}
+	return <-reply
+}
+
+func (s *session) Get(args KeyArgs, reply *PairReply) error {
+	return s.do(args.TxID, func(ctx kvl.Ctx) error {
+		var err error
+		reply.Pair, err = ctx.Get(args.Key)
+		return err
+	})
+}
+
+func (s *session) Range(args RangeArgs, reply *PairsReply) error {
+	return s.do(args.TxID, func(ctx kvl.Ctx) error {
+		var err error
+		reply.Pairs, err = ctx.Range(args.Query)
+		return err
+	})
+}
+
+func (s *session) Set(args SetArgs, reply *WriteReply) error {
+	return s.do(args.TxID, func(ctx kvl.Ctx) error {
+		err := ctx.Set(args.Pair)
+		reply.Size, _ = kvl.TxSizeOf(ctx)
+		return err
+	})
+}
+
+func (s *session) Delete(args KeyArgs, reply *WriteReply) error {
+	return s.do(args.TxID, func(ctx kvl.Ctx) error {
+		err := ctx.Delete(args.Key)
+		reply.Size, _ = kvl.TxSizeOf(ctx)
+		return err
+	})
+}
+
+// End ends the current attempt of a transaction. The reply says whether the
+// client must run its Tx again; otherwise the transaction is finished, and
+// its error (if any) is returned.
+func (s *session) End(args EndArgs, reply *EndReply) error {
+	st, err := s.getTx(args.TxID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case st.ops <- txOp{end: true, abort: !args.Commit}:
+	case <-st.done:
+	case <-s.gone:
+		return errClientGone
+	}
+
+	select {
+	case <-st.retry:
+		reply.Status = endRetry
+		return nil
+	case <-st.done:
+	}
+	res := st.res
+
+	s.mu.Lock()
+	delete(s.txs, args.TxID)
+	if res.wr != nil {
+		if s.watches == nil {
+			// connection closed meanwhile
+			res.wr.Close()
+		} else {
+			s.nextID++
+			reply.WatchID = s.nextID
+			s.watches[reply.WatchID] = res.wr
+		}
+	}
+	s.mu.Unlock()
+
+	reply.Status = endDone
+	if res.err == errTxAborted {
+		return nil
+	}
+	return res.err
+}
+
+// WaitWatch blocks until the watch's Done channel is closed, and returns its
+// error.
+func (s *session) WaitWatch(args WatchArgs, reply *Empty) error {
+	s.mu.Lock()
+	wr := s.watches[args.WatchID]
+	s.mu.Unlock()
+	if wr == nil {
+		return errUnknownWatch
+	}
+
+	select {
+	case <-wr.Done():
+		return wr.Error()
+	case <-s.gone:
+		return errClientGone
+	}
+}
+
+func (s *session) CloseWatch(args WatchArgs, reply *Empty) error {
+	s.mu.Lock()
+	wr := s.watches[args.WatchID]
+	delete(s.watches, args.WatchID)
+	s.mu.Unlock()
+
+	if wr != nil {
+		wr.Close()
+	}
+	return nil
+}
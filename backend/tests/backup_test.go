@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/backup"
+)
+
+func dumpToBuffer(t *testing.T, db kvl.DB, opts *backup.Options) *bytes.Buffer {
+	var buf bytes.Buffer
+	_, err := backup.Dump(&buf, db, opts)
+	if err != nil {
+		t.Fatalf("Couldn't dump: %v", err)
+	}
+	return &buf
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	for _, consistent := range []bool{false, true} {
+		src := ram.New()
+		writeNumbered(t, src, 0, 250)
+		want := dumpDB(t, src)
+
+		var buf bytes.Buffer
+		stats, err := backup.Dump(&buf, src, &backup.Options{
+			ChunkSize:  30,
+			Consistent: consistent,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't dump: %v", err)
+		}
+		if stats.Pairs != int64(len(want)) {
+			t.Errorf("Dump wrote %v pairs, wanted %v", stats.Pairs, len(want))
+		}
+
+		dst := ram.New()
+		restored, err := backup.Restore(&buf, dst, &backup.Options{ChunkSize: 7})
+		if err != nil {
+			t.Fatalf("Couldn't restore: %v", err)
+		}
+		if restored != stats {
+			t.Errorf("Restore stats are %+v, wanted %+v", restored, stats)
+		}
+		comparePairs(t, dumpDB(t, dst), want)
+	}
+}
+
+func TestBackupPrefix(t *testing.T) {
+	src := ram.New()
+	writeNumbered(t, kvl.SubDB(src, []byte("a/")), 0, 20)
+	writeNumbered(t, kvl.SubDB(src, []byte("b/")), 0, 5)
+
+	buf := dumpToBuffer(t, src, &backup.Options{Prefix: []byte("a/")})
+
+	dst := ram.New()
+	_, err := backup.Restore(buf, dst, &backup.Options{Prefix: []byte("c/")})
+	if err != nil {
+		t.Fatalf("Couldn't restore: %v", err)
+	}
+
+	want := dumpDB(t, kvl.SubDB(src, []byte("a/")))
+	if n := len(dumpDB(t, dst)); n != len(want) {
+		t.Errorf("Restored %v pairs, wanted %v", n, len(want))
+	}
+	comparePairs(t, dumpDB(t, kvl.SubDB(dst, []byte("c/"))), want)
+}
+
+func TestBackupConsistentUnsupported(t *testing.T) {
+	_, err := backup.Dump(&bytes.Buffer{}, noWatchDB{ram.New()}, &backup.Options{Consistent: true})
+	if err != kvl.ErrSnapshotUnsupported {
+		t.Errorf("Dump returned %v, wanted %v", err, kvl.ErrSnapshotUnsupported)
+	}
+}
+
+func TestBackupCorrupt(t *testing.T) {
+	src := ram.New()
+	writeNumbered(t, src, 0, 50)
+	good := dumpToBuffer(t, src, nil).Bytes()
+
+	versioned := append([]byte(nil), good...)
+	versioned[8] = 99
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, backup.ErrBadMagic},
+		{"bad magic", append([]byte("notadump"), good[8:]...), backup.ErrBadMagic},
+		{"bad version", versioned, backup.UnsupportedVersionError(99)},
+		{"truncated", good[:len(good)-20], backup.ErrTruncatedDump},
+	}
+	for _, test := range tests {
+		_, err := backup.Restore(bytes.NewReader(test.data), ram.New(), nil)
+		if err != test.err {
+			t.Errorf("Restore of %v dump returned %v, wanted %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestBackupExtendedKeys(t *testing.T) {
+	src := ram.New()
+	err := src.RunTx(func(ctx kvl.Ctx) error {
+		for _, k := range []string{"a", "a\x00", "a\x01", "a\xfe", "a\xff", "b"} {
+			err := ctx.Set(kvl.Pair{[]byte(k), []byte(k)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Couldn't write: %v", err)
+	}
+
+	buf := dumpToBuffer(t, src, &backup.Options{ChunkSize: 1})
+	dst := ram.New()
+	_, err = backup.Restore(buf, dst, nil)
+	if err != nil {
+		t.Fatalf("Couldn't restore: %v", err)
+	}
+	comparePairs(t, dumpDB(t, dst), dumpDB(t, src))
+}
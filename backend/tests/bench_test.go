@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/encryptio/kvl"
+)
+
+func fillBenchDB(b *testing.B, db kvl.DB, count int) {
+	const chunk = 1000
+	for i := 0; i < count; i += chunk {
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			for j := i; j < i+chunk && j < count; j++ {
+				key := []byte(fmt.Sprintf("%08d", j))
+				err := ctx.Set(kvl.Pair{key, key})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatalf("Couldn't fill DB: %v", err)
+		}
+	}
+}
+
+func benchRangeLimit(b *testing.B, db kvl.DB, count, limit int, descending bool) {
+	fillBenchDB(b, db, count)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		start := []byte(fmt.Sprintf("%08d", (i*7919)%count))
+		query := kvl.RangeQuery{Low: start, Limit: limit}
+		if descending {
+			query = kvl.RangeQuery{High: start, Limit: limit, Descending: true}
+		}
+		err := db.RunReadTx(func(ctx kvl.Ctx) error {
+			_, err := ctx.Range(query)
+			return err
+		})
+		if err != nil {
+			b.Fatalf("Couldn't run range: %v", err)
+		}
+	}
+}
+
+func benchGet(b *testing.B, db kvl.DB, count int) {
+	fillBenchDB(b, db, count)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		key := []byte(fmt.Sprintf("%08d", (i*7919)%count))
+		err := db.RunReadTx(func(ctx kvl.Ctx) error {
+			_, err := ctx.Get(key)
+			return err
+		})
+		if err != nil {
+			b.Fatalf("Couldn't run get: %v", err)
+		}
+	}
+}
+
+func benchSet(b *testing.B, db kvl.DB, count int) {
+	fillBenchDB(b, db, count)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		key := []byte(fmt.Sprintf("%08d", (i*7919)%count))
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{key, key})
+		})
+		if err != nil {
+			b.Fatalf("Couldn't run set: %v", err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -38,6 +40,20 @@ func TestBoltRangeMaxRandomReplacement(t *testing.T) {
 	testRangeMaxRandomReplacement(t, db)
 }
 
+func TestBoltLimitedRangeAppend(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testLimitedRangeAppend(t, db, true)
+}
+
+func TestBoltLimitedRangePrepend(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testLimitedRangeAppend(t, db, false)
+}
+
 func TestBoltConsistencyWithRAM(t *testing.T) {
 	dir, db := openBolt(t)
 	defer os.RemoveAll(dir)
@@ -51,3 +67,53 @@ func TestBoltWatchBasic(t *testing.T) {
 	defer db.Close()
 	testWatchBasic(t, db)
 }
+
+func TestBoltWatchRange(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testWatchRange(t, db)
+}
+
+func TestBoltWatchChanges(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testWatchChanges(t, db)
+}
+
+func TestBoltGetOutlivesTx(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	err := db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("kept"), []byte("value")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't set: %v", err)
+	}
+
+	var p kvl.Pair
+	err = db.RunReadTx(func(ctx kvl.Ctx) error {
+		p, err = ctx.Get([]byte("kept"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't get: %v", err)
+	}
+
+	// grow the file enough for bolt to remap it
+	pairs := make([]kvl.Pair, 2000)
+	for i := range pairs {
+		pairs[i] = kvl.Pair{[]byte(fmt.Sprintf("grow%04d", i)), bytes.Repeat([]byte("x"), 4096)}
+	}
+	_, err = kvl.BulkLoad(db, kvl.PairSlice(pairs), nil)
+	if err != nil {
+		t.Fatalf("Couldn't grow the DB: %v", err)
+	}
+
+	if string(p.Key) != "kept" || string(p.Value) != "value" {
+		t.Errorf("Pair read in a finished transaction changed to %v", p)
+	}
+}
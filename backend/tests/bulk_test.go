@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/changefeed"
+	"github.com/encryptio/kvl/kvldebug"
+	"github.com/encryptio/kvl/mirror"
+)
+
+// testBulkLoad checks the contents, stats and progress of bulk loads into db,
+// and that FailIfExists fails a batch without writing any of it.
+func testBulkLoad(t *testing.T, db kvl.DB) {
+	err := clearDB(db)
+	if err != nil {
+		t.Fatalf("Couldn't clear DB: %v", err)
+	}
+
+	var watched kvl.WatchResult
+	if kvl.CapabilitiesOf(db).Watch {
+		watched, err = db.WatchTx(func(ctx kvl.Ctx) error {
+			_, err := ctx.Get([]byte("bulk0042"))
+			if err == kvl.ErrNotFound {
+				err = nil
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Couldn't watch: %v", err)
+		}
+		defer watched.Close()
+	}
+
+	const count = 2500
+	pairs := make([]kvl.Pair, count)
+	for i, j := range rand.Perm(count) {
+		pairs[i] = kvl.Pair{[]byte(fmt.Sprintf("bulk%04d", j)), []byte(fmt.Sprintf("value%v", j))}
+	}
+
+	progress := make(chan kvl.BulkStats, 10)
+	stats, err := kvl.BulkLoad(db, kvl.PairSlice(pairs), &kvl.BulkOptions{
+		BatchSize: 1000,
+		Progress:  progress,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't bulk load: %v", err)
+	}
+	close(progress)
+
+	// SubDBs count the bytes of their prefixes too
+	minBytes := int64(8*count + 5*count + 10 + 90*2 + 900*3 + 1500*4)
+	if stats.Pairs != count || stats.Batches != 3 || stats.Bytes < minBytes {
+		t.Errorf("BulkLoad returned stats %+v, wanted %v pairs of %v bytes in 3 batches",
+			stats, count, minBytes)
+	}
+	var reported []kvl.BulkStats
+	for s := range progress {
+		reported = append(reported, s)
+	}
+	if len(reported) != 3 || reported[0].Pairs != 1000 || reported[2] != stats {
+		t.Errorf("BulkLoad reported progress %+v", reported)
+	}
+
+	err = db.RunReadTx(func(ctx kvl.Ctx) error {
+		got, err := ctx.Range(kvl.RangeQuery{})
+		if err != nil {
+			return err
+		}
+		if len(got) != count {
+			t.Fatalf("Got %v pairs after bulk load, wanted %v", len(got), count)
+		}
+		for i, p := range got {
+			if string(p.Key) != fmt.Sprintf("bulk%04d", i) || string(p.Value) != fmt.Sprintf("value%v", i) {
+				t.Fatalf("Got %v at index %v after bulk load", p, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Couldn't read loaded pairs: %v", err)
+	}
+
+	if watched != nil {
+		select {
+		case <-watched.Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("Bulk load did not trigger a watch on a loaded key")
+		}
+	}
+
+	_, err = kvl.BulkLoad(db, kvl.PairSlice([]kvl.Pair{
+		{[]byte("bulk0001"), []byte("first")},
+		{[]byte("bulk0001"), []byte("second")},
+	}), nil)
+	if err != nil {
+		t.Fatalf("Couldn't bulk load duplicate keys: %v", err)
+	}
+	checkBulkValue(t, db, "bulk0001", "second")
+
+	failing := [][]kvl.Pair{
+		{
+			{[]byte("a-new-key"), []byte("x")},
+			{[]byte("bulk0002"), []byte("x")},
+		},
+		{
+			{[]byte("dup"), []byte("x")},
+			{[]byte("a-new-key"), []byte("x")},
+			{[]byte("dup"), []byte("y")},
+		},
+	}
+	for _, load := range failing {
+		stats, err := kvl.BulkLoad(db, kvl.PairSlice(load), &kvl.BulkOptions{FailIfExists: true})
+		var exists *kvl.KeyExistsError
+		if !errors.As(err, &exists) || !errors.Is(err, kvl.ErrKeyExists) {
+			t.Errorf("FailIfExists load of %v returned %v", load, err)
+		} else if key := string(exists.Key); key != "bulk0002" && key != "dup" {
+			t.Errorf("FailIfExists load of %v failed on key %q", load, key)
+		}
+		if stats != (kvl.BulkStats{}) {
+			t.Errorf("Failed load of one batch returned stats %+v", stats)
+		}
+	}
+	checkBulkValue(t, db, "a-new-key", "")
+	checkBulkValue(t, db, "dup", "")
+	checkBulkValue(t, db, "bulk0002", "value2")
+
+	_, err = kvl.BulkLoad(db, kvl.PairSlice([]kvl.Pair{
+		{[]byte("a-new-key"), []byte("x")},
+	}), &kvl.BulkOptions{FailIfExists: true})
+	if err != nil {
+		t.Errorf("FailIfExists load of a new key returned %v", err)
+	}
+	checkBulkValue(t, db, "a-new-key", "x")
+}
+
+// checkBulkValue checks the value of key, where "" means the key is missing.
+func checkBulkValue(t *testing.T, db kvl.DB, key, value string) {
+	var got string
+	err := db.RunReadTx(func(ctx kvl.Ctx) error {
+		p, err := ctx.Get([]byte(key))
+		got = string(p.Value)
+		if err == kvl.ErrNotFound {
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't get %v: %v", key, err)
+	}
+	if got != value {
+		t.Errorf("%v is %q, wanted %q", key, got, value)
+	}
+}
+
+func TestRAMBulkLoad(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+	testBulkLoad(t, db)
+}
+
+func TestBoltBulkLoad(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testBulkLoad(t, db)
+}
+
+func TestRemoteBulkLoad(t *testing.T) {
+	db, done := openRemote(t)
+	defer done()
+	testBulkLoad(t, db)
+}
+
+func TestBulkLoadWrappers(t *testing.T) {
+	testBulkLoad(t, noWatchDB{ram.New()})
+	testBulkLoad(t, kvl.SubDB(ram.New(), []byte("sub")))
+	testBulkLoad(t, &kvldebug.LoggingDB{Inner: ram.New()})
+	testBulkLoad(t, changefeed.New(ram.New()))
+	testBulkLoad(t, mirror.New(ram.New(), ram.New(), mirror.Options{Compare: true}))
+	testBulkLoad(t, openPollWatch())
+}
+
+func TestBulkLoadLimits(t *testing.T) {
+	db, err := ram.OpenOptions("", &ram.Options{Limits: testLimitsValue})
+	if err != nil {
+		t.Fatalf("Couldn't open ram: %v", err)
+	}
+	defer db.Close()
+
+	for _, db := range []kvl.DB{db, kvl.LimitDB(ram.New(), testLimitsValue)} {
+		// batches are not limited by MaxWrites
+		stats, err := kvl.BulkLoad(db, kvl.PairSlice([]kvl.Pair{
+			{[]byte("a"), []byte("1")},
+			{[]byte("b"), []byte("2")},
+			{[]byte("c"), []byte("3")},
+			{[]byte("d"), []byte("4")},
+		}), nil)
+		if err != nil || stats.Pairs != 4 {
+			t.Errorf("Bulk load larger than MaxWrites returned %+v, %v", stats, err)
+		}
+
+		_, err = kvl.BulkLoad(db, kvl.PairSlice([]kvl.Pair{
+			{[]byte("a-long-key"), []byte("1")},
+			{[]byte("an-even-longer-key"), []byte("2")},
+		}), nil)
+		if !errors.Is(err, kvl.ErrTransactionTooLarge) {
+			t.Errorf("Bulk load of a key over MaxKeySize returned %v", err)
+		}
+		checkBulkValue(t, db, "a-long-key", "")
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/changefeed"
+	"github.com/encryptio/kvl/kvldebug"
+	"github.com/encryptio/kvl/mirror"
+	"github.com/encryptio/kvl/pollwatch"
+)
+
+// testCapabilities checks that the capabilities reported for db match its
+// behavior, and are as expected.
+func testCapabilities(t *testing.T, db kvl.DB, want kvl.Capabilities) {
+	caps := kvl.CapabilitiesOf(db)
+	if caps != want {
+		t.Errorf("CapabilitiesOf(%T) = %+v, wanted %+v", db, caps, want)
+	}
+
+	readNothing := func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("capabilities"))
+		if err == kvl.ErrNotFound {
+			err = nil
+		}
+		return err
+	}
+
+	wr, err := db.WatchTx(readNothing)
+	if caps.Watch {
+		if err != nil {
+			t.Errorf("WatchTx returned %v with Watch set", err)
+		} else {
+			if _, ok := wr.(kvl.ChangeWatchResult); ok != caps.ChangeWatch {
+				t.Errorf("WatchTx returned a %T with ChangeWatch %v", wr, caps.ChangeWatch)
+			}
+			wr.Close()
+		}
+	} else if err != kvl.ErrWatchUnsupported {
+		t.Errorf("WatchTx returned %v without Watch set", err)
+	}
+
+	err = kvl.RunSnapshotTx(db, readNothing)
+	if caps.Snapshot && err != nil {
+		t.Errorf("RunSnapshotTx returned %v with Snapshot set", err)
+	} else if !caps.Snapshot && err != kvl.ErrSnapshotUnsupported {
+		t.Errorf("RunSnapshotTx returned %v without Snapshot set", err)
+	}
+}
+
+func TestCapabilitiesRAM(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+	testCapabilities(t, db, kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+		Snapshot:    true,
+	})
+}
+
+func TestCapabilitiesDurableRAM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvl_capabilities_test")
+	if err != nil {
+		t.Fatalf("Couldn't create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openDurableRAM(t, dir, nil)
+	defer db.Close()
+	testCapabilities(t, db, kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+		Snapshot:    true,
+		Durable:     true,
+	})
+}
+
+func TestCapabilitiesBolt(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testCapabilities(t, db, kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+		Snapshot:    true,
+		Durable:     true,
+	})
+}
+
+func TestCapabilitiesWrappers(t *testing.T) {
+	all := kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+		Snapshot:    true,
+	}
+
+	testCapabilities(t, kvl.SubDB(ram.New(), []byte("sub")), all)
+	testCapabilities(t, &kvldebug.LoggingDB{Inner: ram.New()}, all)
+
+	testCapabilities(t, changefeed.New(ram.New()), kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+	})
+	testCapabilities(t, mirror.New(ram.New(), ram.New(), mirror.Options{}), kvl.Capabilities{
+		Watch:       true,
+		ChangeWatch: true,
+	})
+
+	testCapabilities(t, noWatchDB{ram.New()}, kvl.Capabilities{})
+	testCapabilities(t, openPollWatch(), kvl.Capabilities{Watch: true})
+	testCapabilities(t, pollwatch.New(ram.New(), pollwatch.Options{}), all)
+}
+
+func TestCapabilitiesRemote(t *testing.T) {
+	db, done := openRemote(t)
+	defer done()
+	testCapabilities(t, db, kvl.Capabilities{
+		Watch:        true,
+		MultiProcess: true,
+	})
+}
@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/changefeed"
+)
+
+func TestChangeFeedConsistencyWithRAM(t *testing.T) {
+	s := changefeed.New(ram.New())
+	testRandomOpConsistencyWithRAM(t, s)
+}
+
+func TestChangeFeedWatchBasic(t *testing.T) {
+	s := changefeed.New(ram.New())
+	testWatchBasic(t, s)
+}
+
+func TestChangeFeedLog(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+
+	err := feed.RunTx(func(ctx kvl.Ctx) error {
+		err := ctx.Set(kvl.Pair{[]byte("b"), []byte("1")})
+		if err != nil {
+			return err
+		}
+		err = ctx.Set(kvl.Pair{[]byte("a"), []byte("0")})
+		if err != nil {
+			return err
+		}
+		return ctx.Set(kvl.Pair{[]byte("b"), []byte("2")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't write: %v", err)
+	}
+
+	rollback := errors.New("rollback")
+	err = feed.RunTx(func(ctx kvl.Ctx) error {
+		err := ctx.Set(kvl.Pair{[]byte("c"), []byte("3")})
+		if err != nil {
+			return err
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("Rolled back transaction returned %v, wanted %v", err, rollback)
+	}
+
+	err = feed.RunTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("a"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't read: %v", err)
+	}
+
+	err = feed.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Delete([]byte("a"))
+	})
+	if err != nil {
+		t.Fatalf("Couldn't delete: %v", err)
+	}
+
+	entries, err := feed.Read(0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't read log: %v", err)
+	}
+	want := []changefeed.Entry{
+		{Seq: 1, Changes: []changefeed.Change{
+			{Key: []byte("a"), Value: []byte("0")},
+			{Key: []byte("b"), Value: []byte("2")},
+		}},
+		{Seq: 2, Changes: []changefeed.Change{
+			{Key: []byte("a"), Deleted: true},
+		}},
+	}
+	compareEntries(t, entries, want)
+
+	entries, err = feed.Read(1, 0)
+	if err != nil {
+		t.Fatalf("Couldn't read log: %v", err)
+	}
+	compareEntries(t, entries, want[1:])
+
+	latest, err := feed.Latest()
+	if err != nil || latest != 2 {
+		t.Errorf("Latest returned (%v, %v), wanted (2, nil)", latest, err)
+	}
+}
+
+func TestChangeFeedTrim(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+
+	for i := 0; i < 10; i++ {
+		err := feed.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{[]byte(fmt.Sprintf("%02d", i)), []byte("x")})
+		})
+		if err != nil {
+			t.Fatalf("Couldn't write: %v", err)
+		}
+	}
+
+	n, err := feed.Trim()
+	if err != nil || n != 0 {
+		t.Fatalf("Trim without consumers returned (%v, %v), wanted (0, nil)", n, err)
+	}
+
+	for _, ack := range []struct {
+		consumer string
+		seq      uint64
+	}{{"fast", 8}, {"slow", 4}, {"slow", 2}} {
+		err = feed.Ack(ack.consumer, ack.seq)
+		if err != nil {
+			t.Fatalf("Couldn't ack: %v", err)
+		}
+	}
+
+	pos, err := feed.Position("slow")
+	if err != nil || pos != 4 {
+		t.Errorf("Position returned (%v, %v), wanted (4, nil)", pos, err)
+	}
+
+	n, err = feed.Trim()
+	if err != nil || n != 4 {
+		t.Fatalf("Trim returned (%v, %v), wanted (4, nil)", n, err)
+	}
+
+	err = feed.RemoveConsumer("slow")
+	if err != nil {
+		t.Fatalf("Couldn't remove consumer: %v", err)
+	}
+	n, err = feed.Trim()
+	if err != nil || n != 4 {
+		t.Fatalf("Trim returned (%v, %v), wanted (4, nil)", n, err)
+	}
+
+	entries, err := feed.Read(0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't read log: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 9 || entries[1].Seq != 10 {
+		t.Errorf("Got entries %v after trimming, wanted 9 and 10", entries)
+	}
+}
+
+func TestChangeFeedFollow(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seen := make(chan changefeed.Entry, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- feed.Follow(ctx, "follower", func(e changefeed.Entry) error {
+			seen <- e
+			return nil
+		})
+	}()
+
+	for i := 1; i <= 3; i++ {
+		err := feed.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{[]byte("key"), []byte(fmt.Sprint(i))})
+		})
+		if err != nil {
+			t.Fatalf("Couldn't write: %v", err)
+		}
+
+		select {
+		case e := <-seen:
+			if e.Seq != uint64(i) || string(e.Changes[0].Value) != fmt.Sprint(i) {
+				t.Fatalf("Follow delivered %v, wanted entry %v", e, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for entry %v", i)
+		}
+	}
+
+	cancel()
+	<-errCh
+
+	pos, err := feed.Position("follower")
+	if err != nil || pos != 3 {
+		t.Errorf("Position returned (%v, %v), wanted (3, nil)", pos, err)
+	}
+}
+
+func compareEntries(t *testing.T, got, want []changefeed.Entry) {
+	if len(got) != len(want) {
+		t.Fatalf("Got %v entries, wanted %v", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Seq != want[i].Seq {
+			t.Fatalf("Entry %v has seq %v, wanted %v", i, got[i].Seq, want[i].Seq)
+		}
+		if got[i].Time.IsZero() {
+			t.Errorf("Entry %v has no time", i)
+		}
+		if fmt.Sprint(got[i].Changes) != fmt.Sprint(want[i].Changes) {
+			t.Errorf("Entry %v has changes %v, wanted %v", i, got[i].Changes, want[i].Changes)
+		}
+	}
+}
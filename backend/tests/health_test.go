@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/pollwatch"
+)
+
+// testStats checks Ping and the counts reported by Stats. Key counts are only
+// checked if exactKeys is set.
+func testStats(t *testing.T, db kvl.DB, exactKeys bool) {
+	if err := kvl.Ping(db); err != nil {
+		t.Errorf("Ping returned %v", err)
+	}
+
+	err := db.RunTx(func(ctx kvl.Ctx) error {
+		for i := 0; i < 3; i++ {
+			err := ctx.Set(kvl.Pair{[]byte("stats" + strconv.Itoa(i)), []byte("value")})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Couldn't set: %v", err)
+	}
+
+	stats := kvl.StatsOf(db)
+	if exactKeys && stats.Keys != 3 {
+		t.Errorf("Stats().Keys = %v, wanted 3", stats.Keys)
+	}
+	if exactKeys && stats.Bytes < int64(3*len("stats0value")) {
+		t.Errorf("Stats().Bytes = %v, wanted at least %v", stats.Bytes, 3*len("stats0value"))
+	}
+	if stats.Transactions != 0 || stats.Watches != 0 {
+		t.Errorf("Idle Stats() = %+v", stats)
+	}
+
+	wr, err := db.WatchTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("stats0"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't watch: %v", err)
+	}
+	defer wr.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- db.RunReadTx(func(ctx kvl.Ctx) error {
+			// make sure the transaction has started on a remote server
+			_, err := ctx.Get([]byte("stats0"))
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-started:
+			default:
+				close(started)
+			}
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	stats = kvl.StatsOf(db)
+	if stats.Transactions != 1 || stats.Watches != 1 {
+		t.Errorf("Stats() with a transaction and a watch = %+v", stats)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Transaction returned %v", err)
+	}
+}
+
+// testShutdown checks that Shutdown rejects new transactions, fails open
+// watches, and waits for running transactions.
+func testShutdown(t *testing.T, db kvl.DB) {
+	wr, err := db.WatchTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("shutdown"))
+		if err == kvl.ErrNotFound {
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't watch: %v", err)
+	}
+	defer wr.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	txDone := make(chan error)
+	go func() {
+		txDone <- db.RunTx(func(ctx kvl.Ctx) error {
+			select {
+			case <-started:
+			default:
+				close(started)
+			}
+			<-release
+			return ctx.Set(kvl.Pair{[]byte("during"), []byte("shutdown")})
+		})
+	}()
+	<-started
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- kvl.Shutdown(context.Background(), db)
+	}()
+
+	select {
+	case <-wr.Done():
+		if wr.Error() != kvl.ErrClosed {
+			t.Errorf("Watch failed with %v, wanted ErrClosed", wr.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Watch was not failed by Shutdown")
+	}
+
+	// wait for Shutdown to close the DB to new transactions
+	deadline := time.Now().Add(5 * time.Second)
+	for kvl.Ping(db) != kvl.ErrClosed && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := kvl.Ping(db); err != kvl.ErrClosed {
+		t.Errorf("Ping during Shutdown returned %v", err)
+	}
+	err = db.RunReadTx(func(kvl.Ctx) error { return nil })
+	if err != kvl.ErrClosed {
+		t.Errorf("RunReadTx during Shutdown returned %v", err)
+	}
+	_, err = db.WatchTx(func(kvl.Ctx) error { return nil })
+	if err != kvl.ErrClosed {
+		t.Errorf("WatchTx during Shutdown returned %v", err)
+	}
+
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned %v before the running transaction finished", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-txDone; err != nil {
+		t.Errorf("Running transaction failed with %v", err)
+	}
+	if err := <-shutdownDone; err != nil {
+		t.Errorf("Shutdown returned %v", err)
+	}
+
+	if err := kvl.Shutdown(context.Background(), db); err != kvl.ErrClosed {
+		t.Errorf("Second Shutdown returned %v", err)
+	}
+}
+
+func TestRAMStats(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+	testStats(t, db, true)
+}
+
+func TestRAMShutdown(t *testing.T) {
+	testShutdown(t, ram.New())
+}
+
+func TestRAMShutdownTimeout(t *testing.T) {
+	db := ram.New()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	txDone := make(chan error)
+	go func() {
+		txDone <- db.RunReadTx(func(kvl.Ctx) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := kvl.Shutdown(ctx, db)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Shutdown with a running transaction returned %v", err)
+	}
+
+	close(release)
+	<-txDone
+}
+
+func TestBoltStats(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testStats(t, db, true)
+}
+
+func TestBoltShutdown(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	testShutdown(t, db)
+}
+
+func TestRemoteStats(t *testing.T) {
+	db, done := openRemote(t)
+	defer done()
+	testStats(t, db, true)
+}
+
+func TestRemoteShutdown(t *testing.T) {
+	db, done := openRemote(t)
+	defer done()
+	testShutdown(t, db)
+}
+
+func TestPollWatchShutdown(t *testing.T) {
+	db := pollwatch.New(noWatchDB{ram.New()}, pollwatch.Options{
+		Interval: time.Hour,
+	})
+
+	wr, err := db.WatchTx(func(kvl.Ctx) error { return nil })
+	if err != nil {
+		t.Fatalf("Couldn't watch: %v", err)
+	}
+	defer wr.Close()
+
+	if err := kvl.Shutdown(context.Background(), db); err != nil {
+		t.Errorf("Shutdown returned %v", err)
+	}
+
+	select {
+	case <-wr.Done():
+		if wr.Error() != kvl.ErrClosed {
+			t.Errorf("Polled watch failed with %v, wanted ErrClosed", wr.Error())
+		}
+	default:
+		t.Errorf("Polled watch was not failed by Shutdown")
+	}
+}
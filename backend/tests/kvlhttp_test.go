@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/kvlhttp"
+)
+
+// postJSON posts req to the handler and decodes the response into resp,
+// returning the status code.
+func postJSON(t *testing.T, h http.Handler, path string, req, resp interface{}) int {
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Couldn't marshal request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+
+	if resp != nil {
+		err = json.Unmarshal(rec.Body.Bytes(), resp)
+		if err != nil {
+			t.Fatalf("Couldn't unmarshal response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+type httpPair struct {
+	Key   json.RawMessage `json:"key"`
+	Value []byte          `json:"value"`
+}
+
+func TestHTTPBasic(t *testing.T) {
+	db := ram.New()
+	h := kvlhttp.NewHandler(db, nil)
+
+	for _, k := range []string{"a", "b", "c"} {
+		code := postJSON(t, h, "/set", map[string]interface{}{"key": []byte(k), "value": []byte("v" + k)}, nil)
+		if code != 200 {
+			t.Fatalf("/set returned %v", code)
+		}
+	}
+
+	var p httpPair
+	code := postJSON(t, h, "/get", map[string]interface{}{"key": []byte("b")}, &p)
+	if code != 200 || string(p.Value) != "vb" {
+		t.Errorf("/get returned %v %+v, wanted 200 with value vb", code, p)
+	}
+
+	code = postJSON(t, h, "/delete", map[string]interface{}{"key": []byte("b")}, nil)
+	if code != 200 {
+		t.Errorf("/delete returned %v", code)
+	}
+	code = postJSON(t, h, "/get", map[string]interface{}{"key": []byte("b")}, nil)
+	if code != 404 {
+		t.Errorf("/get of a deleted key returned %v, wanted 404", code)
+	}
+
+	var rangeResp struct {
+		Pairs []httpPair `json:"pairs"`
+	}
+	code = postJSON(t, h, "/range", map[string]interface{}{"descending": true, "limit": 1}, &rangeResp)
+	if code != 200 || len(rangeResp.Pairs) != 1 || string(rangeResp.Pairs[0].Value) != "vc" {
+		t.Errorf("/range returned %v %+v, wanted c", code, rangeResp)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/get", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned %v, wanted %v", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	ro := kvlhttp.NewHandler(db, &kvlhttp.Options{ReadOnly: true})
+	code = postJSON(t, ro, "/set", map[string]interface{}{"key": []byte("x")}, nil)
+	if code != http.StatusForbidden {
+		t.Errorf("/set on a read-only handler returned %v, wanted %v", code, http.StatusForbidden)
+	}
+}
+
+func TestHTTPTupleKeys(t *testing.T) {
+	db := ram.New()
+	h := kvlhttp.NewHandler(db, nil)
+
+	code := postJSON(t, h, "/set?keys=tuple", map[string]interface{}{
+		"key":   []interface{}{"users", 42, map[string]interface{}{"bytes": []byte{0xff}}},
+		"value": []byte("x"),
+	}, nil)
+	if code != 200 {
+		t.Fatalf("/set returned %v", code)
+	}
+
+	var rangeResp struct {
+		Pairs []httpPair `json:"pairs"`
+	}
+	postJSON(t, h, "/range?keys=tuple", map[string]interface{}{}, &rangeResp)
+	if len(rangeResp.Pairs) != 1 {
+		t.Fatalf("Got %v pairs, wanted 1", len(rangeResp.Pairs))
+	}
+	if got, want := string(rangeResp.Pairs[0].Key), `["users",42,{"bytes":"/w=="}]`; got != want {
+		t.Errorf("Key is %v, wanted %v", got, want)
+	}
+}
+
+func TestHTTPTx(t *testing.T) {
+	db := ram.New()
+	h := kvlhttp.NewHandler(db, nil)
+
+	tx := func(exists bool) map[string]interface{} {
+		return map[string]interface{}{
+			"preconditions": []interface{}{
+				map[string]interface{}{"key": []byte("lock"), "exists": exists},
+			},
+			"ops": []interface{}{
+				map[string]interface{}{"op": "set", "key": []byte("lock"), "value": []byte("held")},
+				map[string]interface{}{"op": "delete", "key": []byte("missing")},
+			},
+		}
+	}
+
+	code := postJSON(t, h, "/tx", tx(false), nil)
+	if code != 200 {
+		t.Fatalf("/tx returned %v", code)
+	}
+
+	var errResp struct {
+		Error string `json:"error"`
+		Index int    `json:"index"`
+	}
+	code = postJSON(t, h, "/tx", tx(false), &errResp)
+	if code != http.StatusConflict || errResp.Index != 0 {
+		t.Errorf("/tx with a failing precondition returned %v %+v, wanted 409", code, errResp)
+	}
+
+	code = postJSON(t, h, "/tx", map[string]interface{}{
+		"preconditions": []interface{}{
+			map[string]interface{}{"key": []byte("lock"), "value": []byte("held")},
+		},
+	}, nil)
+	if code != 200 {
+		t.Errorf("/tx with a value precondition returned %v", code)
+	}
+}
+
+func TestHTTPWatch(t *testing.T) {
+	db := ram.New()
+	h := kvlhttp.NewHandler(db, nil)
+
+	type watchResp struct {
+		Token   string      `json:"token"`
+		Changed bool        `json:"changed"`
+		Keys    []*httpPair `json:"keys"`
+	}
+	req := map[string]interface{}{"keys": []interface{}{[]byte("k")}}
+
+	var initial watchResp
+	postJSON(t, h, "/watch", req, &initial)
+	if initial.Token == "" || initial.Changed || initial.Keys[0] != nil {
+		t.Fatalf("Initial /watch returned %+v", initial)
+	}
+
+	req["since"] = initial.Token
+	req["timeout_ms"] = 20
+	var timedOut watchResp
+	postJSON(t, h, "/watch", req, &timedOut)
+	if timedOut.Changed || timedOut.Token != initial.Token {
+		t.Errorf("/watch without changes returned %+v", timedOut)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		db.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{[]byte("k"), []byte("v")})
+		})
+	}()
+
+	req["timeout_ms"] = 5000
+	var changed watchResp
+	start := time.Now()
+	postJSON(t, h, "/watch", req, &changed)
+	if !changed.Changed || changed.Keys[0] == nil || string(changed.Keys[0].Value) != "v" {
+		t.Errorf("/watch after a change returned %+v", changed)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("/watch took %v to see the change", time.Since(start))
+	}
+}
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/kvlresp"
+)
+
+// respClient is a minimal Redis client, rendering replies as strings: simple
+// strings and errors with their prefixes, integers as ":n", bulk strings
+// quoted, null as "nil", and arrays in brackets.
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func openRESP(t *testing.T) (*respClient, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen: %v", err)
+	}
+
+	db := ram.New()
+	server := kvlresp.NewServer(db)
+	go server.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't connect: %v", err)
+	}
+
+	return &respClient{t, conn, bufio.NewReader(conn)}, func() {
+		conn.Close()
+		server.Close()
+		db.Close()
+	}
+}
+
+func (c *respClient) do(args ...string) string {
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return c.read()
+}
+
+func (c *respClient) read() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Couldn't read reply: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+', '-', ':':
+		return line
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		buf := make([]byte, n+2)
+		_, err = io.ReadFull(c.r, buf)
+		if err != nil {
+			c.t.Fatalf("Couldn't read reply: %v", err)
+		}
+		return strconv.Quote(string(buf[:n]))
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		var elements []string
+		for i := 0; i < n; i++ {
+			elements = append(elements, c.read())
+		}
+		return "[" + strings.Join(elements, " ") + "]"
+	}
+	c.t.Fatalf("Unknown reply %q", line)
+	return ""
+}
+
+func (c *respClient) expect(want string, args ...string) {
+	if got := c.do(args...); got != want {
+		c.t.Errorf("%v returned %v, wanted %v", args, got, want)
+	}
+}
+
+func TestRESPCommands(t *testing.T) {
+	c, done := openRESP(t)
+	defer done()
+
+	c.expect("+PONG", "PING")
+	c.expect("nil", "GET", "a")
+	c.expect("+OK", "SET", "a", "hello")
+	c.expect(`"hello"`, "get", "a")
+	c.expect(":1", "EXISTS", "a", "b")
+	c.expect(":1", "INCR", "n")
+	c.expect(":11", "INCRBY", "n", "10")
+	c.expect(":10", "DECR", "n")
+	c.expect("-ERR value is not an integer or out of range", "INCR", "a")
+	c.expect(":2", "DEL", "a", "n", "missing")
+	c.expect("-ERR wrong number of arguments for 'get' command", "GET")
+	c.expect("-ERR unknown command 'flushall'", "FLUSHALL")
+
+	// inline commands, as typed into telnet
+	fmt.Fprintf(c.conn, "SET inline value\r\n")
+	if got := c.read(); got != "+OK" {
+		t.Errorf("Inline SET returned %v", got)
+	}
+	c.expect(`"value"`, "GET", "inline")
+}
+
+func TestRESPMulti(t *testing.T) {
+	c, done := openRESP(t)
+	defer done()
+
+	c.expect("+OK", "SET", "s", "x")
+	c.expect("+OK", "MULTI")
+	c.expect("+QUEUED", "INCR", "n")
+	c.expect("+QUEUED", "INCR", "s")
+	c.expect("+QUEUED", "GET", "n")
+	c.expect(`[:1 -ERR value is not an integer or out of range "1"]`, "EXEC")
+
+	c.expect("+OK", "MULTI")
+	c.expect("+QUEUED", "SET", "n", "5")
+	c.expect("+OK", "DISCARD")
+	c.expect(`"1"`, "GET", "n")
+
+	c.expect("+OK", "MULTI")
+	c.expect("-ERR wrong number of arguments for 'set' command", "SET", "n")
+	c.expect("-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	c.expect("-ERR EXEC without MULTI", "EXEC")
+}
+
+func TestRESPScan(t *testing.T) {
+	c, done := openRESP(t)
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		c.expect("+OK", "SET", fmt.Sprintf("user:%d", i), "x")
+	}
+	c.expect("+OK", "SET", "other", "x")
+
+	var got []string
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "2")
+		var keys string
+		_, err := fmt.Sscanf(reply, "[%q [", &cursor)
+		if err != nil {
+			t.Fatalf("Couldn't parse SCAN reply %v: %v", reply, err)
+		}
+		keys = reply[strings.Index(reply, " [")+2 : len(reply)-2]
+		if keys != "" {
+			got = append(got, strings.Fields(keys)...)
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+
+	want := `"user:0" "user:1" "user:2" "user:3" "user:4"`
+	if strings.Join(got, " ") != want {
+		t.Errorf("SCAN returned %v, wanted %v", got, want)
+	}
+
+	c.expect("-ERR only MATCH patterns of the form prefix* are supported", "SCAN", "0", "MATCH", "u*r")
+}
+
+func TestRESPBadArrayLength(t *testing.T) {
+	for _, header := range []string{"*-1", "*x", "*99999999999"} {
+		c, done := openRESP(t)
+
+		fmt.Fprintf(c.conn, "%s\r\n", header)
+		if got := c.read(); got != "-ERR Protocol error" {
+			t.Errorf("Command header %q returned %v", header, got)
+		}
+
+		done()
+	}
+}
+
+func TestRESPLongLine(t *testing.T) {
+	c, done := openRESP(t)
+	defer done()
+
+	// the line is rejected before its end is reached
+	c.conn.Write(bytes.Repeat([]byte("a"), 64*1024))
+	if got := c.read(); got != "-ERR Protocol error" {
+		t.Errorf("Line over 64KB returned %v", got)
+	}
+}
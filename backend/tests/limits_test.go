@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/bolt"
+	"github.com/encryptio/kvl/backend/ram"
+)
+
+var testLimitsValue = kvl.Limits{
+	MaxWrites:     3,
+	MaxWriteBytes: 100,
+	MaxKeySize:    10,
+	MaxValueSize:  50,
+}
+
+// testLimits checks that db enforces testLimitsValue.
+func testLimits(t *testing.T, db kvl.DB) {
+	checkTooLarge := func(err error, limit string) {
+		var tooLarge *kvl.TransactionTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != limit {
+			t.Errorf("Got %v, wanted a TransactionTooLargeError for %v", err, limit)
+		}
+		if !errors.Is(err, kvl.ErrTransactionTooLarge) {
+			t.Errorf("%v does not match ErrTransactionTooLarge", err)
+		}
+	}
+
+	err := clearDB(db)
+	if err != nil {
+		t.Fatalf("Couldn't clear DB: %v", err)
+	}
+
+	err = db.RunTx(func(ctx kvl.Ctx) error {
+		err := ctx.Delete([]byte("missing"))
+		if err != kvl.ErrNotFound {
+			t.Errorf("Delete of missing key returned %v", err)
+		}
+
+		for _, k := range []string{"a", "b", "c"} {
+			err := ctx.Set(kvl.Pair{[]byte(k), []byte("value")})
+			if err != nil {
+				return err
+			}
+		}
+
+		size, ok := kvl.TxSizeOf(ctx)
+		if !ok || size != (kvl.TxSize{Writes: 3, Bytes: 18}) {
+			t.Errorf("TxSizeOf = %+v, %v after three writes", size, ok)
+		}
+
+		err = ctx.Set(kvl.Pair{[]byte("d"), []byte("value")})
+		checkTooLarge(err, "MaxWrites")
+		return err
+	})
+	checkTooLarge(err, "MaxWrites")
+
+	err = db.RunReadTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("a"))
+		return err
+	})
+	if err != kvl.ErrNotFound {
+		t.Errorf("Transaction that exceeded its limits was committed (Get returned %v)", err)
+	}
+
+	tooLarge := []struct {
+		limit string
+		pairs []kvl.Pair
+	}{
+		{"MaxKeySize", []kvl.Pair{{bytes.Repeat([]byte("k"), 11), nil}}},
+		{"MaxValueSize", []kvl.Pair{{[]byte("k"), bytes.Repeat([]byte("v"), 51)}}},
+		{"MaxWriteBytes", []kvl.Pair{
+			{[]byte("a"), bytes.Repeat([]byte("v"), 50)},
+			{[]byte("b"), bytes.Repeat([]byte("v"), 50)},
+		}},
+	}
+	for _, test := range tooLarge {
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			for _, p := range test.pairs {
+				err := ctx.Set(p)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		checkTooLarge(err, test.limit)
+	}
+}
+
+func TestLimitDB(t *testing.T) {
+	db := kvl.LimitDB(ram.New(), testLimitsValue)
+	defer db.Close()
+	testLimits(t, db)
+	testRandomOpConsistencyWithRAM(t, kvl.LimitDB(ram.New(), kvl.Limits{}))
+}
+
+func TestRAMLimits(t *testing.T) {
+	db, err := ram.OpenOptions("", &ram.Options{Limits: testLimitsValue})
+	if err != nil {
+		t.Fatalf("Couldn't open ram: %v", err)
+	}
+	defer db.Close()
+	testLimits(t, db)
+}
+
+func TestRAMURLLimits(t *testing.T) {
+	db, err := kvl.OpenURL("ram:?max_writes=3&max_write_bytes=100&max_key_size=10&max_value_size=50")
+	if err != nil {
+		t.Fatalf("Couldn't open ram: %v", err)
+	}
+	defer db.Close()
+	testLimits(t, db)
+}
+
+func TestBoltLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvl_bolt_test")
+	if err != nil {
+		t.Fatalf("Couldn't create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bolt.OpenOptions(filepath.Join(dir, "db"), &bolt.Options{Limits: testLimitsValue})
+	if err != nil {
+		t.Fatalf("Couldn't open bolt: %v", err)
+	}
+	defer db.Close()
+	testLimits(t, db)
+}
+
+func TestRemoteLimits(t *testing.T) {
+	inner, err := ram.OpenOptions("", &ram.Options{Limits: testLimitsValue})
+	if err != nil {
+		t.Fatalf("Couldn't open ram: %v", err)
+	}
+	db, done := serveRemote(t, inner)
+	defer done()
+	testLimits(t, db)
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/migrate"
+)
+
+func TestMigrateCopy(t *testing.T) {
+	src := ram.New()
+	dst := ram.New()
+	writeNumbered(t, src, 0, 100)
+
+	// stale and extra pairs in the destination are fixed up
+	writeNumbered(t, dst, 50, 150)
+	err := dst.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("00060"), []byte("stale")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't write: %v", err)
+	}
+
+	err = migrate.Verify(dst, src, nil)
+	if err != migrate.ErrChecksumMismatch {
+		t.Errorf("Verify before copying returned %v, wanted %v", err, migrate.ErrChecksumMismatch)
+	}
+
+	progress := make(chan migrate.Stats, 100)
+	stats, err := migrate.Copy(dst, src, &migrate.Options{ChunkSize: 10}, progress)
+	close(progress)
+	if err != nil {
+		t.Fatalf("Couldn't copy: %v", err)
+	}
+	if stats.Checked != uint64(len(dumpDB(t, src))) || stats.Resume != nil {
+		t.Errorf("Copy returned stats %v with Resume %q", stats, stats.Resume)
+	}
+	var chunks int
+	for range progress {
+		chunks++
+	}
+	if chunks < 2 {
+		t.Errorf("Got %v progress reports, wanted one per chunk", chunks)
+	}
+
+	comparePairs(t, dumpDB(t, dst), dumpDB(t, src))
+	err = migrate.Verify(dst, src, &migrate.Options{ChunkSize: 7})
+	if err != nil {
+		t.Errorf("Verify after copying returned %v", err)
+	}
+
+	// a catch-up pass copies only what changed
+	writeNumbered(t, src, 100, 105)
+	stats, err = migrate.Copy(dst, src, nil, nil)
+	if err != nil {
+		t.Fatalf("Couldn't copy: %v", err)
+	}
+	if stats.Copied != 5 || stats.Deleted != 1 {
+		t.Errorf("Catch-up pass returned %v, wanted 5 copied and 1 deleted", stats)
+	}
+	comparePairs(t, dumpDB(t, dst), dumpDB(t, src))
+}
+
+func TestMigrateResume(t *testing.T) {
+	src := ram.New()
+	dst := ram.New()
+	writeNumbered(t, src, 0, 30)
+
+	stats, err := migrate.Copy(dst, src, &migrate.Options{Start: []byte("00015")}, nil)
+	if err != nil {
+		t.Fatalf("Couldn't copy: %v", err)
+	}
+
+	var want []kvl.Pair
+	for _, p := range dumpDB(t, src) {
+		if string(p.Key) >= "00015" {
+			want = append(want, p)
+		}
+	}
+	if stats.Checked != uint64(len(want)) {
+		t.Errorf("Resumed copy checked %v pairs, wanted %v", stats.Checked, len(want))
+	}
+	comparePairs(t, dumpDB(t, dst), want)
+}
+
+func TestMigrateExtendedKeys(t *testing.T) {
+	src := ram.New()
+	dst := ram.New()
+	err := src.RunTx(func(ctx kvl.Ctx) error {
+		for _, k := range []string{"a", "a\x00", "a\x01", "a\xfe", "a\xff", "b"} {
+			err := ctx.Set(kvl.Pair{[]byte(k), []byte(k)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Couldn't write: %v", err)
+	}
+
+	_, err = migrate.Copy(dst, src, &migrate.Options{ChunkSize: 1}, nil)
+	if err != nil {
+		t.Fatalf("Couldn't copy: %v", err)
+	}
+	comparePairs(t, dumpDB(t, dst), dumpDB(t, src))
+
+	sum, err := migrate.Checksum(dst, &migrate.Options{ChunkSize: 1})
+	if err != nil || sum.Pairs != 6 {
+		t.Errorf("Checksum returned (%v, %v), wanted 6 pairs", sum, err)
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/mirror"
+)
+
+// failingDB fails every read/write transaction with err.
+type failingDB struct {
+	kvl.DB
+	err error
+}
+
+func (f failingDB) RunTx(kvl.Tx) error {
+	return f.err
+}
+
+func TestMirrorConsistencyWithRAM(t *testing.T) {
+	s := mirror.New(ram.New(), ram.New(), mirror.Options{
+		Compare: true,
+		OnDivergence: func(d mirror.Divergence) {
+			t.Errorf("Unexpected divergence: %v", d)
+		},
+	})
+	testRandomOpConsistencyWithRAM(t, s)
+}
+
+func TestMirrorCopiesWrites(t *testing.T) {
+	primary, shadow := ram.New(), ram.New()
+	s := mirror.New(primary, shadow, mirror.Options{})
+	writeNumbered(t, s, 0, 50)
+	comparePairs(t, dumpDB(t, shadow), dumpDB(t, primary))
+}
+
+func TestMirrorDivergence(t *testing.T) {
+	primary, shadow := ram.New(), ram.New()
+	writeNumbered(t, primary, 0, 5)
+	writeNumbered(t, shadow, 0, 4)
+
+	var divergences []mirror.Divergence
+	s := mirror.New(primary, shadow, mirror.Options{
+		Compare: true,
+		OnDivergence: func(d mirror.Divergence) {
+			divergences = append(divergences, d)
+		},
+	})
+
+	err := s.RunReadTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("00004"))
+		if err != nil {
+			return err
+		}
+		_, err = ctx.Get([]byte("00001"))
+		if err != nil {
+			return err
+		}
+		_, err = ctx.Range(kvl.RangeQuery{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't read: %v", err)
+	}
+
+	if len(divergences) != 2 || divergences[0].Op != "Get" || divergences[1].Op != "Range" {
+		t.Fatalf("Got divergences %v, wanted a Get and a Range", divergences)
+	}
+	if divergences[0].ShadowErr != kvl.ErrNotFound {
+		t.Errorf("Get divergence has shadow error %v, wanted %v",
+			divergences[0].ShadowErr, kvl.ErrNotFound)
+	}
+}
+
+func TestMirrorFailurePolicy(t *testing.T) {
+	shadowErr := errors.New("shadow is down")
+	write := func(s kvl.DB) error {
+		return s.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{[]byte("key"), []byte("value")})
+		})
+	}
+
+	var reported int
+	onErr := func(err error) {
+		if err != shadowErr {
+			t.Errorf("Reported shadow error %v, wanted %v", err, shadowErr)
+		}
+		reported++
+	}
+
+	s := mirror.New(ram.New(), failingDB{ram.New(), shadowErr}, mirror.Options{
+		Policy:        mirror.ReportShadowErrors,
+		OnShadowError: onErr,
+	})
+	if err := write(s); err != nil {
+		t.Errorf("RunTx returned %v with ReportShadowErrors", err)
+	}
+
+	s = mirror.New(ram.New(), failingDB{ram.New(), shadowErr}, mirror.Options{
+		Policy:        mirror.ReturnShadowErrors,
+		OnShadowError: onErr,
+	})
+	if err, ok := write(s).(*mirror.ShadowError); !ok || err.Err != shadowErr {
+		t.Errorf("RunTx returned %v with ReturnShadowErrors, wanted a ShadowError", err)
+	}
+
+	s = mirror.New(ram.New(), failingDB{ram.New(), shadowErr}, mirror.Options{
+		Policy:        mirror.DisableShadow,
+		OnShadowError: onErr,
+	})
+	for i := 0; i < 3; i++ {
+		if err := write(s); err != nil {
+			t.Errorf("RunTx returned %v with DisableShadow", err)
+		}
+	}
+
+	if reported != 3 {
+		t.Errorf("Shadow errors were reported %v times, wanted 3", reported)
+	}
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/pollwatch"
+)
+
+// noWatchDB hides the watch support of the DB it wraps.
+type noWatchDB struct {
+	kvl.DB
+}
+
+func (noWatchDB) WatchTx(kvl.Tx) (kvl.WatchResult, error) {
+	return nil, kvl.ErrWatchUnsupported
+}
+
+func openPollWatch() kvl.DB {
+	return pollwatch.New(noWatchDB{ram.New()}, pollwatch.Options{
+		Interval: 5 * time.Millisecond,
+		Jitter:   5 * time.Millisecond,
+	})
+}
+
+func TestPollWatchBasic(t *testing.T) {
+	s := openPollWatch()
+	defer s.Close()
+	testWatchBasic(t, s)
+}
+
+func TestPollWatchRange(t *testing.T) {
+	s := openPollWatch()
+	defer s.Close()
+	testWatchRange(t, s)
+}
+
+func TestPollWatchUnchanged(t *testing.T) {
+	s := openPollWatch()
+	defer s.Close()
+
+	wr, err := s.WatchTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Range(kvl.RangeQuery{Low: []byte("a"), High: []byte("b")})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't watch: %v", err)
+	}
+	defer wr.Close()
+
+	err = s.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("c"), []byte("value")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't set value: %v", err)
+	}
+
+	select {
+	case <-wr.Done():
+		t.Errorf("Watch fired for a write outside its range")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
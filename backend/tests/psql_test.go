@@ -33,6 +33,18 @@ func TestPSQLRangeMaxRandomReplacement(t *testing.T) {
 	testRangeMaxRandomReplacement(t, s)
 }
 
+func TestPSQLLimitedRangeAppend(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testLimitedRangeAppend(t, s, true)
+}
+
+func TestPSQLLimitedRangePrepend(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testLimitedRangeAppend(t, s, false)
+}
+
 func TestPSQLConsistencyWithRAM(t *testing.T) {
 	s := openPSQL(t)
 	defer s.Close()
@@ -44,3 +56,57 @@ func TestPSQLWatchBasic(t *testing.T) {
 	defer s.Close()
 	testWatchBasic(t, s)
 }
+
+func TestPSQLWatchRange(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testWatchRange(t, s)
+}
+
+func TestPSQLWatchChanges(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testWatchChanges(t, s)
+}
+
+func TestPSQLCapabilities(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testCapabilities(t, s, kvl.Capabilities{
+		Watch:        true,
+		Durable:      true,
+		MultiProcess: true,
+	})
+}
+
+func TestPSQLStats(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testStats(t, s, false)
+}
+
+func TestPSQLTxInfo(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testTxInfo(t, s, true, false)
+}
+
+func TestPSQLLimits(t *testing.T) {
+	dsn := os.Getenv("PSQL_DSN")
+	if dsn == "" {
+		t.Skip("Set PSQL_DSN to enable PostgreSQL tests")
+	}
+
+	s, err := psql.OpenOptions(dsn, &psql.Options{Limits: testLimitsValue})
+	if err != nil {
+		t.Fatalf("Couldn't open psql driver: %v", err)
+	}
+	defer s.Close()
+	testLimits(t, s)
+}
+
+func TestPSQLBulkLoad(t *testing.T) {
+	s := openPSQL(t)
+	defer s.Close()
+	testBulkLoad(t, s)
+}
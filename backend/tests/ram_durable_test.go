@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+)
+
+func openDurableRAM(t *testing.T, dir string, opts *ram.Options) kvl.DB {
+	db, err := ram.OpenOptions(dir, opts)
+	if err != nil {
+		t.Fatalf("Couldn't open durable ram DB: %v", err)
+	}
+	return db
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kvl_ram_test")
+	if err != nil {
+		t.Fatalf("Couldn't create temporary dir: %v", err)
+	}
+	return dir
+}
+
+func TestDurableRAMShuffleShardedIncrement(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openDurableRAM(t, dir, &ram.Options{NoSync: true, SnapshotBytes: 64 * 1024})
+	defer db.Close()
+	testShuffleShardedIncrement(t, db)
+}
+
+func TestDurableRAMConsistencyWithRAM(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openDurableRAM(t, dir, &ram.Options{NoSync: true, SnapshotBytes: 4096})
+	defer db.Close()
+	testRandomOpConsistencyWithRAM(t, db)
+}
+
+func TestDurableRAMWatchBasic(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openDurableRAM(t, dir, nil)
+	defer db.Close()
+	testWatchBasic(t, db)
+}
+
+func TestDurableRAMRecovery(t *testing.T) {
+	for _, snapshotBytes := range []int64{0, 2048} {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		opts := &ram.Options{SnapshotBytes: snapshotBytes}
+
+		db := openDurableRAM(t, dir, opts)
+		writeNumbered(t, db, 0, 500)
+		want := dumpDB(t, db)
+		db.Close()
+
+		if snapshotBytes > 0 {
+			_, err := os.Stat(filepath.Join(dir, "snapshot"))
+			if err != nil {
+				t.Errorf("Snapshot was not written: %v", err)
+			}
+		}
+
+		db = openDurableRAM(t, dir, opts)
+		comparePairs(t, dumpDB(t, db), want)
+
+		// keep going after recovery
+		writeNumbered(t, db, 500, 600)
+		want = dumpDB(t, db)
+		db.Close()
+
+		db = openDurableRAM(t, dir, opts)
+		comparePairs(t, dumpDB(t, db), want)
+		db.Close()
+	}
+}
+
+func TestDurableRAMTornLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	db := openDurableRAM(t, dir, nil)
+	writeNumbered(t, db, 0, 100)
+	want := dumpDB(t, db)
+	db.Close()
+
+	logs, err := filepath.Glob(filepath.Join(dir, "wal.*"))
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("Couldn't find log file: %v %v", logs, err)
+	}
+
+	// simulate a crash in the middle of writing a record
+	f, err := os.OpenFile(logs[0], os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatalf("Couldn't open log file: %v", err)
+	}
+	_, err = f.Write([]byte{0, 0, 0, 40, 1, 2, 3, 4, 5})
+	f.Close()
+	if err != nil {
+		t.Fatalf("Couldn't write to log file: %v", err)
+	}
+
+	db = openDurableRAM(t, dir, nil)
+	comparePairs(t, dumpDB(t, db), want)
+
+	writeNumbered(t, db, 100, 110)
+	want = dumpDB(t, db)
+	db.Close()
+
+	db = openDurableRAM(t, dir, nil)
+	comparePairs(t, dumpDB(t, db), want)
+	db.Close()
+}
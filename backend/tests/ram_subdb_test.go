@@ -19,6 +19,18 @@ func TestSubDBRangeMaxRandomReplacement(t *testing.T) {
 	testRangeMaxRandomReplacement(t, subdb)
 }
 
+func TestSubDBLimitedRangeAppend(t *testing.T) {
+	s := ram.New()
+	subdb := kvl.SubDB(s, []byte("some\x00prefix"))
+	testLimitedRangeAppend(t, subdb, true)
+}
+
+func TestSubDBLimitedRangePrepend(t *testing.T) {
+	s := ram.New()
+	subdb := kvl.SubDB(s, []byte("some\x00prefix"))
+	testLimitedRangeAppend(t, subdb, false)
+}
+
 func TestSubDBConsistencyWithRAM(t *testing.T) {
 	s := ram.New()
 	subdb := kvl.SubDB(s, []byte("some\x00prefix"))
@@ -30,3 +42,15 @@ func TestSubDBWatchBasic(t *testing.T) {
 	subdb := kvl.SubDB(s, []byte("some\x00prefix"))
 	testWatchBasic(t, subdb)
 }
+
+func TestSubDBWatchRange(t *testing.T) {
+	s := ram.New()
+	subdb := kvl.SubDB(s, []byte("some\x00prefix"))
+	testWatchRange(t, subdb)
+}
+
+func TestSubDBWatchChanges(t *testing.T) {
+	s := ram.New()
+	subdb := kvl.SubDB(s, []byte("some\x00prefix"))
+	testWatchChanges(t, subdb)
+}
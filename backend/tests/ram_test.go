@@ -1,8 +1,11 @@
 package tests
 
 import (
+	"fmt"
+	"strconv"
 	"testing"
 
+	"github.com/encryptio/kvl"
 	"github.com/encryptio/kvl/backend/ram"
 )
 
@@ -16,6 +19,16 @@ func TestRAMRangeMaxRandomReplacement(t *testing.T) {
 	testRangeMaxRandomReplacement(t, s)
 }
 
+func TestRAMLimitedRangeAppend(t *testing.T) {
+	s := ram.New()
+	testLimitedRangeAppend(t, s, true)
+}
+
+func TestRAMLimitedRangePrepend(t *testing.T) {
+	s := ram.New()
+	testLimitedRangeAppend(t, s, false)
+}
+
 func TestRAMConsistencyWithRAM(t *testing.T) {
 	s := ram.New()
 	testRandomOpConsistencyWithRAM(t, s)
@@ -25,3 +38,203 @@ func TestRAMWatchBasic(t *testing.T) {
 	s := ram.New()
 	testWatchBasic(t, s)
 }
+
+func TestRAMWatchRange(t *testing.T) {
+	s := ram.New()
+	testWatchRange(t, s)
+}
+
+func TestRAMWatchChanges(t *testing.T) {
+	s := ram.New()
+	testWatchChanges(t, s)
+}
+
+func TestRAMLimitedRangePrecision(t *testing.T) {
+	tests := []struct {
+		Query       kvl.RangeQuery
+		Write       string
+		WantRetries bool
+	}{
+		{kvl.RangeQuery{Limit: 3}, "2", true},
+		{kvl.RangeQuery{Limit: 3}, "25", false},
+		{kvl.RangeQuery{Limit: 3}, "7", false},
+		{kvl.RangeQuery{Limit: 3, Descending: true}, "7", true},
+		{kvl.RangeQuery{Limit: 3, Descending: true}, "65", false},
+		{kvl.RangeQuery{Limit: 3, Descending: true}, "2", false},
+		{kvl.RangeQuery{Low: []byte("2"), High: []byte("6"), Limit: 10}, "7", false},
+		{kvl.RangeQuery{Low: []byte("2"), High: []byte("6"), Limit: 10}, "55", true},
+	}
+
+	for _, test := range tests {
+		db := ram.New()
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			for i := 0; i < 10; i++ {
+				key := []byte(strconv.Itoa(i))
+				err := ctx.Set(kvl.Pair{key, key})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Couldn't add testing rows: %v", err)
+		}
+
+		attempts := 0
+		err = db.RunTx(func(ctx kvl.Ctx) error {
+			attempts++
+
+			_, err := ctx.Range(test.Query)
+			if err != nil {
+				return err
+			}
+
+			if attempts == 1 {
+				err = db.RunTx(func(ctx kvl.Ctx) error {
+					return ctx.Set(kvl.Pair{[]byte(test.Write), []byte("new")})
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return ctx.Set(kvl.Pair{[]byte("result"), []byte("x")})
+		})
+		if err != nil {
+			t.Fatalf("Couldn't run transaction: %v", err)
+		}
+
+		if gotRetries := attempts > 1; gotRetries != test.WantRetries {
+			t.Errorf("Range(%+v) with concurrent write to %q retried = %v, wanted %v",
+				test.Query, test.Write, gotRetries, test.WantRetries)
+		}
+	}
+}
+
+func BenchmarkRAMGet(b *testing.B) {
+	benchGet(b, ram.New(), 100000)
+}
+
+func BenchmarkRAMSet(b *testing.B) {
+	benchSet(b, ram.New(), 100000)
+}
+
+func BenchmarkRAMRangeLimit10(b *testing.B) {
+	benchRangeLimit(b, ram.New(), 100000, 10, false)
+}
+
+func BenchmarkRAMRangeLimit10Descending(b *testing.B) {
+	benchRangeLimit(b, ram.New(), 100000, 10, true)
+}
+
+func BenchmarkRAMRangeLimit1000(b *testing.B) {
+	benchRangeLimit(b, ram.New(), 100000, 1000, false)
+}
+
+func BenchmarkRAMSetWith10000Watchers(b *testing.B) {
+	db := ram.New()
+	fillBenchDB(b, db, 100000)
+
+	for i := 0; i < 10000; i++ {
+		low := []byte(fmt.Sprintf("%08d", i*10))
+		high := []byte(fmt.Sprintf("%08d", i*10+5))
+		wr, err := db.WatchTx(func(ctx kvl.Ctx) error {
+			_, err := ctx.Range(kvl.RangeQuery{Low: low, High: high})
+			return err
+		})
+		if err != nil {
+			b.Fatalf("Couldn't watch: %v", err)
+		}
+		defer wr.Close()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// never inside a watched range
+		key := []byte(fmt.Sprintf("%08d", (i*10+7)%100000))
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{key, key})
+		})
+		if err != nil {
+			b.Fatalf("Couldn't run set: %v", err)
+		}
+	}
+}
+
+func TestRAMCloneAndRestore(t *testing.T) {
+	db := ram.New().(*ram.DB)
+	writeNumbered(t, db, 0, 100)
+	original := dumpDB(t, db)
+
+	snap := db.Snapshot()
+	clone := db.Clone()
+
+	writeNumbered(t, db, 100, 120)
+	comparePairs(t, dumpDB(t, clone), original)
+
+	err := clone.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("clone"), []byte("only")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't write to clone: %v", err)
+	}
+	err = db.RunReadTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("clone"))
+		return err
+	})
+	if err != kvl.ErrNotFound {
+		t.Errorf("Write to clone was visible in original, got err %v", err)
+	}
+
+	wr, err := db.WatchTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("00110"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't watch: %v", err)
+	}
+	defer wr.Close()
+
+	err = db.Restore(snap)
+	if err != nil {
+		t.Fatalf("Couldn't restore snapshot: %v", err)
+	}
+	comparePairs(t, dumpDB(t, db), original)
+
+	select {
+	case <-wr.Done():
+	default:
+		t.Errorf("Restore did not trigger watch on a changed key")
+	}
+}
+
+func TestRAMSubscribe(t *testing.T) {
+	db := ram.New().(*ram.DB)
+	defer db.Close()
+
+	sub := db.Subscribe(2)
+	writeNumbered(t, db, 0, 2)
+
+	for i := 0; i < 2; i++ {
+		c := <-sub.Commits()
+		if c.Version != uint64(i+1) || len(c.Changes) != 1 ||
+			string(c.Changes[0].Key) != fmt.Sprintf("%05d", i) {
+			t.Errorf("Got commit %v, wanted version %v writing %05d", c, i+1, i)
+		}
+	}
+
+	// nothing is receiving, so the buffer overflows
+	writeNumbered(t, db, 2, 5)
+	for range sub.Commits() {
+	}
+	if sub.Err() != ram.ErrSubscriptionOverflow {
+		t.Errorf("Err returned %v, wanted %v", sub.Err(), ram.ErrSubscriptionOverflow)
+	}
+
+	sub = db.Subscribe(10)
+	sub.Close()
+	if _, ok := <-sub.Commits(); ok || sub.Err() != nil {
+		t.Errorf("Closed subscription delivered a commit or returned error %v", sub.Err())
+	}
+}
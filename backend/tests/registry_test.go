@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/encryptio/kvl"
+	_ "github.com/encryptio/kvl/backend/bolt"
+	_ "github.com/encryptio/kvl/backend/ram"
+)
+
+func TestRegistryBackends(t *testing.T) {
+	found := make(map[string]bool)
+	for _, b := range kvl.Backends() {
+		if b.Description == "" {
+			t.Errorf("Backend %v has no description", b.Name)
+		}
+		found[b.Name] = true
+	}
+	for _, name := range []string{"bolt", "ram"} {
+		if !found[name] {
+			t.Errorf("Backends() does not list %v", name)
+		}
+	}
+}
+
+func TestRegistryUnknownBackend(t *testing.T) {
+	_, err := kvl.Open("nonexistent", "")
+	if err != kvl.UnknownBackendError("nonexistent") {
+		t.Errorf("Open of unknown backend returned %v", err)
+	}
+
+	_, err = kvl.OpenURL("nonexistent://foo")
+	if err != kvl.UnknownBackendError("nonexistent") {
+		t.Errorf("OpenURL of unknown backend returned %v", err)
+	}
+}
+
+func TestRegistryOpenURLRAM(t *testing.T) {
+	db, err := kvl.OpenURL("ram:")
+	if err != nil {
+		t.Fatalf("Couldn't open ram: %v", err)
+	}
+	testShuffleShardedIncrement(t, db)
+	db.Close()
+
+	_, err = kvl.OpenURL("ram:?bogus=1")
+	if err == nil {
+		t.Errorf("OpenURL with an unknown option succeeded")
+	}
+}
+
+func TestRegistryOpenURLBolt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvl_registry_test")
+	if err != nil {
+		t.Fatalf("Couldn't create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db")
+
+	db, err := kvl.OpenURL("bolt://" + path + "?timeout=1s&nosync=1&mode=0600")
+	if err != nil {
+		t.Fatalf("Couldn't open bolt: %v", err)
+	}
+	err = db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("a"), []byte("1")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't set: %v", err)
+	}
+	db.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Couldn't stat db file: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("db file has mode %v, wanted 0600", fi.Mode().Perm())
+	}
+
+	db, err = kvl.OpenURL("bolt://" + path + "?readonly")
+	if err != nil {
+		t.Fatalf("Couldn't open bolt read-only: %v", err)
+	}
+	defer db.Close()
+
+	err = db.RunReadTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Get([]byte("a"))
+		return err
+	})
+	if err != nil {
+		t.Errorf("Couldn't read from read-only db: %v", err)
+	}
+
+	err = db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("b"), []byte("2")})
+	})
+	if err == nil {
+		t.Errorf("Write to read-only db succeeded")
+	}
+
+	_, err = kvl.OpenURL("bolt://" + path + "?timeout=soon")
+	if err == nil {
+		t.Errorf("OpenURL with a bad timeout succeeded")
+	}
+}
+
+func init() {
+	// registered once, since the registry is global and tests may run more
+	// than once
+	kvl.Register(kvl.Backend{
+		Name:        "test-nourl",
+		Description: "a backend without URL support, for tests",
+		Open: func(string) (kvl.DB, error) {
+			return nil, errors.New("not openable")
+		},
+	})
+}
+
+func TestRegistryURLUnsupported(t *testing.T) {
+	_, err := kvl.OpenURL("test-nourl:x")
+	if !errors.Is(err, kvl.ErrURLUnsupported) {
+		t.Errorf("OpenURL of backend without URL support returned %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/backend/remote"
+)
+
+// openRemote serves a new ram DB on localhost and returns a client for it,
+// and a function that shuts both down.
+func openRemote(t testing.TB) (kvl.DB, func()) {
+	return serveRemote(t, ram.New())
+}
+
+// serveRemote serves inner on localhost and returns a client for it, and a
+// function that shuts both down.
+func serveRemote(t testing.TB, inner kvl.DB) (kvl.DB, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen: %v", err)
+	}
+
+	server := remote.NewServer(inner)
+	go server.Serve(l)
+
+	db, err := kvl.Open("remote", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't connect: %v", err)
+	}
+
+	return db, func() {
+		db.Close()
+		server.Close()
+		inner.Close()
+	}
+}
+
+func TestRemoteShuffleShardedIncrement(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+	testShuffleShardedIncrement(t, s)
+}
+
+func TestRemoteRangeMaxRandomReplacement(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+	testRangeMaxRandomReplacement(t, s)
+}
+
+func TestRemoteLimitedRangeAppend(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+	testLimitedRangeAppend(t, s, true)
+}
+
+func TestRemoteConsistencyWithRAM(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+	testRandomOpConsistencyWithRAM(t, s)
+}
+
+func TestRemoteWatchBasic(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+	testWatchBasic(t, s)
+}
+
+func TestRemoteWatchRange(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+	testWatchRange(t, s)
+}
+
+func TestRemoteSharedBetweenClients(t *testing.T) {
+	s, done := openRemote(t)
+	defer done()
+
+	// a second client of the same server
+	other, err := remote.Dial(s.(*remote.DB).Addr())
+	if err != nil {
+		t.Fatalf("Couldn't connect: %v", err)
+	}
+	defer other.Close()
+
+	writeNumbered(t, s, 0, 20)
+	comparePairs(t, dumpDB(t, other), dumpDB(t, s))
+
+	err = other.RunReadTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("a"), []byte("b")})
+	})
+	if err != kvl.ErrReadOnlyTx {
+		t.Errorf("Set in a read transaction returned %v, wanted %v", err, kvl.ErrReadOnlyTx)
+	}
+}
+
+func TestRemoteServerDBShutdown(t *testing.T) {
+	inner := ram.New()
+	db, done := serveRemote(t, inner)
+	defer done()
+
+	err := kvl.Shutdown(context.Background(), inner)
+	if err != nil {
+		t.Fatalf("Couldn't shut down the served DB: %v", err)
+	}
+
+	// the served DB returns without running the Tx, so the client's first
+	// operation must not wait for it
+	errs := make(chan error, 3)
+	go func() {
+		errs <- db.RunTx(func(ctx kvl.Ctx) error {
+			_, err := ctx.Get([]byte("key"))
+			return err
+		})
+		errs <- db.RunReadTx(func(kvl.Ctx) error { return nil })
+		_, err := db.WatchTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{[]byte("key"), []byte("value")})
+		})
+		errs <- err
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if err != kvl.ErrClosed {
+				t.Errorf("Transaction on a shut down server DB returned %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Transaction on a shut down server DB hung")
+		}
+	}
+}
+
+func TestRemoteIdleTimeout(t *testing.T) {
+	inner := ram.New()
+	defer inner.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen: %v", err)
+	}
+	server := remote.NewServer(inner)
+	server.IdleTimeout = 50 * time.Millisecond
+	go server.Serve(l)
+	defer server.Close()
+
+	db, err := remote.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't connect: %v", err)
+	}
+	defer db.Close()
+
+	// the client goes silent in the middle of its transaction
+	attempts := 0
+	err = db.RunTx(func(ctx kvl.Ctx) error {
+		attempts++
+		err := ctx.Set(kvl.Pair{[]byte("early"), []byte("x")})
+		if err != nil {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+		return ctx.Set(kvl.Pair{[]byte("late"), []byte("x")})
+	})
+	if err == nil {
+		t.Errorf("Transaction that was idle past its timeout committed")
+	}
+	if attempts != 1 {
+		t.Errorf("Idle transaction was run %v times", attempts)
+	}
+
+	pairs := dumpDB(t, inner)
+	if len(pairs) != 0 {
+		t.Errorf("DB contains %v after the idle transaction was rolled back", pairs)
+	}
+
+	// transactions that keep talking are unaffected
+	writeNumbered(t, db, 0, 5)
+}
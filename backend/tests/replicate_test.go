@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/changefeed"
+	"github.com/encryptio/kvl/replicate"
+)
+
+func TestReplicateStep(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+	target := ram.New()
+	defer target.Close()
+
+	writeNumbered(t, feed, 0, 25)
+
+	r := replicate.New(feed, target, replicate.Options{
+		BatchSize: 10,
+		Consumer:  "replica",
+	})
+
+	lag, err := r.Lag()
+	if err != nil || lag.Entries != 25 || lag.Time <= 0 {
+		t.Errorf("Lag returned (%+v, %v), wanted 25 entries", lag, err)
+	}
+
+	for _, want := range []int{10, 10, 5, 0} {
+		n, err := r.Step()
+		if err != nil || n != want {
+			t.Fatalf("Step returned (%v, %v), wanted (%v, nil)", n, err, want)
+		}
+	}
+
+	comparePairs(t, dumpDB(t, replicate.Data(target)), dumpDB(t, feed))
+
+	lag, err = r.Lag()
+	if err != nil || lag != (replicate.Lag{}) {
+		t.Errorf("Lag returned (%+v, %v), wanted zero", lag, err)
+	}
+
+	pos, err := feed.Position("replica")
+	if err != nil || pos != 25 {
+		t.Errorf("Feed position is (%v, %v), wanted (25, nil)", pos, err)
+	}
+
+	// a second replicator on the same target picks up where the first left
+	// off instead of reapplying anything
+	writeNumbered(t, feed, 25, 30)
+	r2 := replicate.New(feed, target, replicate.Options{})
+	n, err := r2.Step()
+	if err != nil || n != 5 {
+		t.Fatalf("Step returned (%v, %v), wanted (5, nil)", n, err)
+	}
+	comparePairs(t, dumpDB(t, replicate.Data(target)), dumpDB(t, feed))
+}
+
+func TestReplicateTrimmed(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+	target := ram.New()
+	defer target.Close()
+
+	writeNumbered(t, feed, 0, 5)
+	err := feed.Ack("other", 3)
+	if err != nil {
+		t.Fatalf("Couldn't ack: %v", err)
+	}
+	_, err = feed.Trim()
+	if err != nil {
+		t.Fatalf("Couldn't trim: %v", err)
+	}
+
+	r := replicate.New(feed, target, replicate.Options{})
+	_, err = r.Step()
+	if err != replicate.ErrLogTrimmed {
+		t.Errorf("Step returned %v, wanted %v", err, replicate.ErrLogTrimmed)
+	}
+}
+
+func TestReplicateRun(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+	target := ram.New()
+	defer target.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := replicate.New(feed, target, replicate.Options{BatchSize: 3})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Run(ctx)
+	}()
+
+	writeNumbered(t, feed, 0, 10)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		applied, err := r.Applied()
+		if err != nil {
+			t.Fatalf("Couldn't get applied position: %v", err)
+		}
+		if applied == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Replicator only applied %v of 10 entries", applied)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	comparePairs(t, dumpDB(t, replicate.Data(target)), dumpDB(t, feed))
+
+	cancel()
+	err := <-errCh
+	if err != context.Canceled {
+		t.Errorf("Run returned %v, wanted %v", err, context.Canceled)
+	}
+}
+
+func TestReplicateRunClosed(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	target := ram.New()
+	defer target.Close()
+
+	r := replicate.New(feed, target, replicate.Options{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Run(context.Background())
+	}()
+
+	writeNumbered(t, feed, 0, 3)
+	feed.Close()
+
+	select {
+	case err := <-errCh:
+		if err != kvl.ErrClosed {
+			t.Errorf("Run returned %v, wanted %v", err, kvl.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after the feed was closed")
+	}
+}
+
+func TestReplicateRunTrimmedToEnd(t *testing.T) {
+	feed := changefeed.New(ram.New())
+	defer feed.Close()
+	target := ram.New()
+	defer target.Close()
+
+	// another consumer acknowledges everything, so nothing is left after
+	// trimming
+	writeNumbered(t, feed, 0, 5)
+	err := feed.Ack("other", 5)
+	if err != nil {
+		t.Fatalf("Couldn't ack: %v", err)
+	}
+	_, err = feed.Trim()
+	if err != nil {
+		t.Fatalf("Couldn't trim: %v", err)
+	}
+
+	r := replicate.New(feed, target, replicate.Options{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Run(context.Background())
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != replicate.ErrLogTrimmed {
+			t.Errorf("Run returned %v, wanted %v", err, replicate.ErrLogTrimmed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not report a log trimmed past the empty target")
+	}
+}
@@ -264,3 +264,101 @@ func testRangeMaxRandomReplacement(t *testing.T, s kvl.DB) {
 			max, parallelism*transactionsPerGoroutine)
 	}
 }
+
+func testLimitedRangeAppend(t *testing.T, s kvl.DB, descending bool) {
+	// This test runs several goroutines which each find the last (or first,
+	// if not descending) key in a log with a limited range query, and write
+	// the key after (or before) it.
+	//
+	// Afterwards, it ensures that no two transactions wrote the same key,
+	// which would happen if the limited range reads did not conflict with the
+	// neighboring writes.
+
+	const (
+		transactionsPerGoroutine = 50
+		parallelism              = 4
+		start                    = 100000
+	)
+
+	err := clearDB(s)
+	if err != nil {
+		t.Fatalf("Couldn't clear DB: %v", err)
+	}
+
+	logKey := func(n int64) []byte {
+		return []byte(fmt.Sprintf("log/%08d", n))
+	}
+
+	err = s.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{logKey(start), []byte("0")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't add testing rows: %v", err)
+	}
+
+	errCh := make(chan error, parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			for j := 0; j < transactionsPerGoroutine; j++ {
+				err := s.RunTx(func(ctx kvl.Ctx) error {
+					pairs, err := ctx.Range(kvl.RangeQuery{
+						Low:        []byte("log/"),
+						High:       []byte("log0"),
+						Limit:      1,
+						Descending: descending,
+					})
+					if err != nil {
+						return err
+					}
+					if len(pairs) != 1 {
+						return fmt.Errorf("got %v pairs from log, wanted 1", len(pairs))
+					}
+
+					n, err := strconv.ParseInt(string(pairs[0].Key[4:]), 10, 0)
+					if err != nil {
+						return err
+					}
+					if descending {
+						n++
+					} else {
+						n--
+					}
+
+					return ctx.Set(kvl.Pair{logKey(n), []byte("0")})
+				})
+				if err != nil {
+					errCh <- err
+					return
+				}
+			}
+			errCh <- nil
+		}()
+	}
+
+	for i := 0; i < parallelism; i++ {
+		err := <-errCh
+		if err != nil {
+			t.Fatalf("Couldn't run appending transaction: %v", err)
+		}
+	}
+
+	var count int
+	err = s.RunReadTx(func(ctx kvl.Ctx) error {
+		pairs, err := ctx.Range(kvl.RangeQuery{})
+		count = len(pairs)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't run count transaction: %v", err)
+	}
+
+	err = clearDB(s)
+	if err != nil {
+		t.Fatalf("Couldn't clear DB: %v", err)
+	}
+
+	if count != parallelism*transactionsPerGoroutine+1 {
+		t.Errorf("limited range append got %v keys at end, wanted %v",
+			count, parallelism*transactionsPerGoroutine+1)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+	"github.com/encryptio/kvl/changefeed"
+	"github.com/encryptio/kvl/kvldebug"
+	"github.com/encryptio/kvl/mirror"
+)
+
+// testTxInfo checks the TxInfo of transactions run on db. If retries is set,
+// it also forces a retry by writing a key read by a running transaction, which
+// deadlocks on DBs that serialize read/write transactions.
+func testTxInfo(t *testing.T, db kvl.DB, retries, hasReadVersion bool) {
+	before := time.Now()
+
+	var infos []kvl.TxInfo
+	run := func(run func(kvl.Tx) error) kvl.TxInfo {
+		err := run(func(ctx kvl.Ctx) error {
+			info, ok := kvl.TxInfoOf(ctx)
+			if !ok {
+				t.Errorf("Ctx %T has no TxInfo", ctx)
+			}
+			infos = append(infos, info)
+			return ctx.Set(kvl.Pair{[]byte("txinfo"), []byte("x")})
+		})
+		if err == kvl.ErrReadOnlyTx {
+			err = nil
+		}
+		if err != nil {
+			t.Fatalf("Transaction failed: %v", err)
+		}
+		return infos[len(infos)-1]
+	}
+
+	write := run(db.RunTx)
+	if write.Attempt != 1 || write.ReadOnly {
+		t.Errorf("RunTx info = %+v", write)
+	}
+	if write.Start.Before(before) || write.Start.After(time.Now()) {
+		t.Errorf("RunTx info has Start %v, outside the test", write.Start)
+	}
+	if write.HasReadVersion != hasReadVersion {
+		t.Errorf("RunTx info has HasReadVersion %v", write.HasReadVersion)
+	}
+
+	read := run(db.RunReadTx)
+	if read.Attempt != 1 || !read.ReadOnly {
+		t.Errorf("RunReadTx info = %+v", read)
+	}
+	if read.ID == write.ID {
+		t.Errorf("Two transactions have the same ID %v", read.ID)
+	}
+	if hasReadVersion && read.ReadVersion <= write.ReadVersion {
+		t.Errorf("Read after a commit has version %v, not after %v",
+			read.ReadVersion, write.ReadVersion)
+	}
+
+	if !retries {
+		return
+	}
+
+	infos = nil
+	err := db.RunTx(func(ctx kvl.Ctx) error {
+		info, _ := kvl.TxInfoOf(ctx)
+		infos = append(infos, info)
+
+		_, err := ctx.Get([]byte("txinfo"))
+		if err != nil {
+			return err
+		}
+		if info.Attempt == 1 {
+			err := db.RunTx(func(ctx kvl.Ctx) error {
+				return ctx.Set(kvl.Pair{[]byte("txinfo"), []byte("conflict")})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return ctx.Set(kvl.Pair{[]byte("txinfo"), []byte("retried")})
+	})
+	if err != nil {
+		t.Fatalf("Conflicting transaction failed: %v", err)
+	}
+
+	if len(infos) < 2 {
+		t.Fatalf("Conflicting transaction was not retried")
+	}
+	first, last := infos[0], infos[len(infos)-1]
+	if last.Attempt != len(infos) {
+		t.Errorf("Attempt %v has Attempt %v", len(infos), last.Attempt)
+	}
+	if last.ID != first.ID || !last.Start.Equal(first.Start) {
+		t.Errorf("Retry changed ID or Start: first %+v, last %+v", first, last)
+	}
+}
+
+func TestRAMTxInfo(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+	testTxInfo(t, db, true, true)
+
+	err := kvl.RunSnapshotTx(db, func(ctx kvl.Ctx) error {
+		info, ok := kvl.TxInfoOf(ctx)
+		if !ok || info.Attempt != 1 || !info.ReadOnly || !info.HasReadVersion {
+			t.Errorf("RunSnapshotTx info = %+v", info)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunSnapshotTx failed: %v", err)
+	}
+}
+
+func TestBoltTxInfo(t *testing.T) {
+	dir, db := openBolt(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	testTxInfo(t, db, false, true)
+}
+
+func TestRemoteTxInfo(t *testing.T) {
+	db, done := openRemote(t)
+	defer done()
+	testTxInfo(t, db, true, false)
+}
+
+func TestTxInfoWrappers(t *testing.T) {
+	testTxInfo(t, kvl.SubDB(ram.New(), []byte("sub")), true, true)
+	testTxInfo(t, &kvldebug.LoggingDB{Inner: ram.New()}, true, true)
+	testTxInfo(t, changefeed.New(ram.New()), true, true)
+	testTxInfo(t, mirror.New(ram.New(), ram.New(), mirror.Options{Compare: true}), false, true)
+	testTxInfo(t, openPollWatch(), true, true)
+
+	err := noWatchDB{ram.New()}.RunTx(func(ctx kvl.Ctx) error {
+		if _, ok := kvl.TxInfoOf(kvl.SubCtx(fakeCtx{ctx}, []byte("x"))); ok {
+			t.Errorf("TxInfoOf a wrapped Ctx without TxInfo returned ok")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+}
+
+// fakeCtx hides the TxInfo method of a Ctx.
+type fakeCtx struct {
+	kvl.Ctx
+}
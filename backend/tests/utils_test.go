@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"fmt"
+	"testing"
+
 	"github.com/encryptio/kvl"
 )
 
@@ -26,3 +29,46 @@ func clearDB(s kvl.DB) error {
 	})
 	return err
 }
+
+func writeNumbered(t *testing.T, db kvl.DB, from, to int) {
+	for i := from; i < to; i++ {
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			key := []byte(fmt.Sprintf("%05d", i))
+			if i%7 == 3 {
+				// delete an earlier key too, so replay sees deletions
+				err := ctx.Delete([]byte(fmt.Sprintf("%05d", i-3)))
+				if err != nil && err != kvl.ErrNotFound {
+					return err
+				}
+			}
+			return ctx.Set(kvl.Pair{key, key})
+		})
+		if err != nil {
+			t.Fatalf("Couldn't write key %v: %v", i, err)
+		}
+	}
+}
+
+func dumpDB(t *testing.T, db kvl.DB) []kvl.Pair {
+	var pairs []kvl.Pair
+	err := db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		pairs, err = ctx.Range(kvl.RangeQuery{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't read DB: %v", err)
+	}
+	return pairs
+}
+
+func comparePairs(t *testing.T, got, want []kvl.Pair) {
+	if len(got) != len(want) {
+		t.Fatalf("Got %v pairs, wanted %v", len(got), len(want))
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("Pair %v is %v, wanted %v", i, got[i], want[i])
+		}
+	}
+}
@@ -59,3 +59,104 @@ func testWatchBasic(t *testing.T, db kvl.DB) {
 		t.Errorf("Got error from WatchResult: %v", gotErr)
 	}
 }
+
+func testWatchRange(t *testing.T, db kvl.DB) {
+	skipWatchIfUnsupported(t, db)
+
+	err := clearDB(db)
+	if err != nil {
+		t.Fatalf("Couldn't clear DB: %v", err)
+	}
+
+	wr, err := db.WatchTx(func(ctx kvl.Ctx) error {
+		_, err := ctx.Range(kvl.RangeQuery{Low: []byte("b"), High: []byte("d")})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't watch: %v", err)
+	}
+	defer wr.Close()
+
+	err = db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{[]byte("c"), []byte("value")})
+	})
+	if err != nil {
+		t.Fatalf("Couldn't set value: %v", err)
+	}
+
+	select {
+	case <-wr.Done():
+		if err := wr.Error(); err != nil {
+			t.Errorf("Got error from WatchResult: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Timed out while waiting for WatchTx result")
+	}
+}
+
+func testWatchChanges(t *testing.T, db kvl.DB) {
+	skipWatchIfUnsupported(t, db)
+
+	err := clearDB(db)
+	if err != nil {
+		t.Fatalf("Couldn't clear DB: %v", err)
+	}
+
+	var lastVersion uint64
+	for i := 0; i < 2; i++ {
+		wr, err := db.WatchTx(func(ctx kvl.Ctx) error {
+			_, err := ctx.Get([]byte("a"))
+			if err != nil && err != kvl.ErrNotFound {
+				return err
+			}
+			_, err = ctx.Range(kvl.RangeQuery{Low: []byte("b"), High: []byte("d")})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Couldn't watch: %v", err)
+		}
+
+		cwr, ok := wr.(kvl.ChangeWatchResult)
+		if !ok {
+			wr.Close()
+			t.Skipf("%T does not report watch changes", db)
+		}
+
+		if _, _, ok := cwr.Changes(); ok {
+			t.Errorf("Changes returned ok before the watch fired")
+		}
+
+		err = db.RunTx(func(ctx kvl.Ctx) error {
+			for _, k := range []string{"z", "c", "a"} {
+				err := ctx.Set(kvl.Pair{[]byte(k), []byte("value")})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Couldn't set values: %v", err)
+		}
+
+		select {
+		case <-wr.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out while waiting for WatchTx result")
+		}
+
+		keys, version, ok := cwr.Changes()
+		if !ok {
+			t.Fatalf("Changes returned !ok after the watch fired")
+		}
+		if len(keys) != 2 || string(keys[0]) != "a" || string(keys[1]) != "c" {
+			t.Errorf("Changes returned keys %q, wanted [a c]", keys)
+		}
+		if version <= lastVersion {
+			t.Errorf("Changes returned version %v, wanted more than %v", version, lastVersion)
+		}
+		lastVersion = version
+
+		wr.Close()
+	}
+}
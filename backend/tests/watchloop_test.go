@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/backend/ram"
+)
+
+func TestWatchLoop(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var value string
+	tx := func(ctx kvl.Ctx) error {
+		p, err := ctx.Get([]byte("key"))
+		if err == kvl.ErrNotFound {
+			value = ""
+			return nil
+		}
+		value = string(p.Value)
+		return err
+	}
+
+	seen := make(chan string, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- kvl.WatchLoop(ctx, db, tx, func() error {
+			seen <- value
+			return nil
+		})
+	}()
+
+	expect := func(want string) {
+		select {
+		case got := <-seen:
+			if got != want {
+				t.Fatalf("WatchLoop delivered %q, wanted %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for WatchLoop to deliver %q", want)
+		}
+	}
+
+	expect("")
+	for _, v := range []string{"a", "b"} {
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			return ctx.Set(kvl.Pair{[]byte("key"), []byte(v)})
+		})
+		if err != nil {
+			t.Fatalf("Couldn't set value: %v", err)
+		}
+		expect(v)
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Errorf("WatchLoop returned %v, wanted %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WatchLoop did not return after cancellation")
+	}
+}
+
+func TestWatchLoopStopsOnChangeError(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+
+	stop := errors.New("stop")
+	err := kvl.WatchLoop(context.Background(), db,
+		func(kvl.Ctx) error { return nil },
+		func() error { return stop })
+	if err != stop {
+		t.Errorf("WatchLoop returned %v, wanted %v", err, stop)
+	}
+}
+
+func TestWatchLoopBacksOffOnError(t *testing.T) {
+	db := ram.New()
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var attempts int32
+	txErr := errors.New("tx failed")
+	err := kvl.WatchLoopWithOptions(ctx, db,
+		func(kvl.Ctx) error {
+			atomic.AddInt32(&attempts, 1)
+			return txErr
+		},
+		func() error {
+			t.Errorf("onChange called after a failed Tx")
+			return nil
+		},
+		kvl.WatchLoopOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond})
+	if err != context.DeadlineExceeded {
+		t.Errorf("WatchLoop returned %v, wanted %v", err, context.DeadlineExceeded)
+	}
+
+	// 0, 10, 30, 70ms
+	if n := atomic.LoadInt32(&attempts); n < 2 || n > 5 {
+		t.Errorf("Tx ran %v times in 100ms, wanted 2-5 with backoff", n)
+	}
+}
+
+func TestWatchLoopUnsupported(t *testing.T) {
+	err := kvl.WatchLoop(context.Background(), noWatchDB{ram.New()},
+		func(kvl.Ctx) error { return nil },
+		func() error { return nil })
+	if err != kvl.ErrWatchUnsupported {
+		t.Errorf("WatchLoop returned %v, wanted %v", err, kvl.ErrWatchUnsupported)
+	}
+}
+
+func TestWatchLoopClosed(t *testing.T) {
+	db := ram.New()
+
+	started := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- kvl.WatchLoop(context.Background(), db,
+			func(kvl.Ctx) error { return nil },
+			func() error {
+				select {
+				case <-started:
+				default:
+					close(started)
+				}
+				return nil
+			})
+	}()
+	<-started
+
+	// fails the running watch, then every later WatchTx
+	db.Close()
+
+	select {
+	case err := <-errCh:
+		if err != kvl.ErrClosed {
+			t.Errorf("WatchLoop returned %v, wanted %v", err, kvl.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WatchLoop did not return after the DB was closed")
+	}
+
+	err := kvl.WatchLoop(context.Background(), db,
+		func(kvl.Ctx) error { return nil },
+		func() error { return nil })
+	if err != kvl.ErrClosed {
+		t.Errorf("WatchLoop on a closed DB returned %v, wanted %v", err, kvl.ErrClosed)
+	}
+}
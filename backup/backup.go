@@ -0,0 +1,368 @@
+// Package backup dumps the contents of a DB to a portable file and restores
+// them into any DB.
+//
+// A dump file starts with the 8 byte magic "kvldump\x00" and a format version
+// byte (currently 1), followed by a gzip stream of chunks. Each chunk is a
+// uvarint pair count, that many pairs (each a uvarint key length, the key, a
+// uvarint value length and the value), and the big-endian CRC-32C of the
+// chunk's bytes. A chunk with a count of zero ends the dump; it is followed by
+// the uvarint total number of pairs.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/keys"
+)
+
+const (
+	magic         = "kvldump\x00"
+	formatVersion = 1
+
+	defaultChunkSize = 1000
+)
+
+var (
+	ErrBadMagic      = errors.New("backup: not a kvl dump file")
+	ErrBadChecksum   = errors.New("backup: checksum mismatch")
+	ErrTruncatedDump = errors.New("backup: dump file is truncated")
+	ErrCorruptDump   = errors.New("backup: dump file is corrupt")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// UnsupportedVersionError is returned by Restore when the dump file was
+// written in a format version it doesn't know.
+type UnsupportedVersionError int
+
+func (e UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("backup: unsupported dump format version %d", int(e))
+}
+
+// Options configures Dump and Restore.
+type Options struct {
+	// Prefix restricts the operation to the keys under the given prefix, as
+	// seen through kvl.SubDB. Dumped keys do not include the prefix, so a dump
+	// may be restored under a different prefix.
+	Prefix []byte
+
+	// ChunkSize is the number of pairs read or written by each transaction.
+	// Zero means 1000.
+	ChunkSize int
+
+	// Consistent makes Dump read the whole DB in a single snapshot with
+	// kvl.RunSnapshotTx, instead of one read transaction per chunk. Dump
+	// returns kvl.ErrSnapshotUnsupported if the DB can't do this.
+	//
+	// Without Consistent, concurrent writes may be partially included in the
+	// dump.
+	Consistent bool
+}
+
+// Stats describes a completed Dump or Restore.
+type Stats struct {
+	Pairs int64
+	Bytes int64 // total length of keys and values
+}
+
+func (o *Options) withDefaults(db kvl.DB) (Options, kvl.DB) {
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	if len(opts.Prefix) > 0 {
+		db = kvl.SubDB(db, opts.Prefix)
+	}
+	return opts, db
+}
+
+// Dump writes the contents of db to w.
+func Dump(w io.Writer, db kvl.DB, o *Options) (Stats, error) {
+	opts, db := o.withDefaults(db)
+
+	_, err := io.WriteString(w, magic+string([]byte{formatVersion}))
+	if err != nil {
+		return Stats{}, err
+	}
+
+	gz := gzip.NewWriter(w)
+	dw := &dumpWriter{w: bufio.NewWriter(gz)}
+
+	if opts.Consistent {
+		err = kvl.RunSnapshotTx(db, func(ctx kvl.Ctx) error {
+			return dumpChunks(ctx.Range, opts.ChunkSize, dw.writeChunk)
+		})
+	} else {
+		rangeTx := func(query kvl.RangeQuery) ([]kvl.Pair, error) {
+			var pairs []kvl.Pair
+			err := db.RunReadTx(func(ctx kvl.Ctx) error {
+				var err error
+				pairs, err = ctx.Range(query)
+				return err
+			})
+			return pairs, err
+		}
+		err = dumpChunks(rangeTx, opts.ChunkSize, dw.writeChunk)
+	}
+	if err != nil {
+		return dw.stats, err
+	}
+
+	err = dw.finish()
+	if err != nil {
+		return dw.stats, err
+	}
+
+	return dw.stats, gz.Close()
+}
+
+// dumpChunks reads all pairs in order in chunks of chunkSize, passing each
+// chunk to fn.
+func dumpChunks(rangeFn func(kvl.RangeQuery) ([]kvl.Pair, error), chunkSize int, fn func([]kvl.Pair) error) error {
+	var low []byte
+	for {
+		pairs, err := rangeFn(kvl.RangeQuery{Low: low, Limit: chunkSize})
+		if err != nil {
+			return err
+		}
+
+		if len(pairs) > 0 {
+			err = fn(pairs)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(pairs) < chunkSize {
+			return nil
+		}
+		low = keys.Successor(pairs[len(pairs)-1].Key)
+	}
+}
+
+type dumpWriter struct {
+	w     *bufio.Writer
+	buf   []byte
+	stats Stats
+}
+
+func (dw *dumpWriter) writeChunk(pairs []kvl.Pair) error {
+	dw.buf = binary.AppendUvarint(dw.buf[:0], uint64(len(pairs)))
+	for _, p := range pairs {
+		dw.buf = binary.AppendUvarint(dw.buf, uint64(len(p.Key)))
+		dw.buf = append(dw.buf, p.Key...)
+		dw.buf = binary.AppendUvarint(dw.buf, uint64(len(p.Value)))
+		dw.buf = append(dw.buf, p.Value...)
+
+		dw.stats.Pairs++
+		dw.stats.Bytes += int64(len(p.Key) + len(p.Value))
+	}
+	dw.buf = binary.BigEndian.AppendUint32(dw.buf, crc32.Checksum(dw.buf, crcTable))
+
+	_, err := dw.w.Write(dw.buf)
+	return err
+}
+
+func (dw *dumpWriter) finish() error {
+	dw.buf = binary.AppendUvarint(dw.buf[:0], 0)
+	dw.buf = binary.AppendUvarint(dw.buf, uint64(dw.stats.Pairs))
+
+	_, err := dw.w.Write(dw.buf)
+	if err != nil {
+		return err
+	}
+	return dw.w.Flush()
+}
+
+// Restore reads a dump from r and writes its pairs into db, one chunk per
+// transaction. Existing keys that are not in the dump are left alone.
+//
+// If the dump turns out to be corrupt or truncated, the chunks before the
+// damage have already been written when the error is returned.
+func Restore(r io.Reader, db kvl.DB, o *Options) (Stats, error) {
+	opts, db := o.withDefaults(db)
+
+	header := make([]byte, len(magic)+1)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrBadMagic
+		}
+		return Stats{}, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return Stats{}, ErrBadMagic
+	}
+	if header[len(magic)] != formatVersion {
+		return Stats{}, UnsupportedVersionError(header[len(magic)])
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer gz.Close()
+
+	dr := &dumpReader{r: bufio.NewReader(gz)}
+	var stats Stats
+	var batch []kvl.Pair
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := db.RunTx(func(ctx kvl.Ctx) error {
+			for _, p := range batch {
+				err := ctx.Set(p)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range batch {
+			stats.Pairs++
+			stats.Bytes += int64(len(p.Key) + len(p.Value))
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		pairs, err := dr.readChunk()
+		if err != nil {
+			return stats, err
+		}
+		if pairs == nil {
+			break
+		}
+
+		for _, p := range pairs {
+			batch = append(batch, p)
+			if len(batch) >= opts.ChunkSize {
+				err = flush()
+				if err != nil {
+					return stats, err
+				}
+			}
+		}
+	}
+
+	err = flush()
+	if err != nil {
+		return stats, err
+	}
+
+	total, err := binary.ReadUvarint(dr.r)
+	if err != nil {
+		return stats, ErrTruncatedDump
+	}
+	if total != uint64(stats.Pairs) {
+		return stats, ErrCorruptDump
+	}
+
+	return stats, nil
+}
+
+type dumpReader struct {
+	r *bufio.Reader
+}
+
+// readChunk returns the pairs of the next chunk, or nil at the end of the
+// dump.
+func (dr *dumpReader) readChunk() ([]kvl.Pair, error) {
+	h := crc32.New(crcTable)
+	tr := &teeByteReader{dr.r, h}
+
+	count, err := binary.ReadUvarint(tr)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	capacity := count
+	if capacity > defaultChunkSize {
+		capacity = defaultChunkSize
+	}
+	pairs := make([]kvl.Pair, 0, capacity)
+	for i := uint64(0); i < count; i++ {
+		key, err := tr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		value, err := tr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, kvl.Pair{key, value})
+	}
+
+	var sum [4]byte
+	_, err = io.ReadFull(dr.r, sum[:])
+	if err != nil {
+		return nil, truncated(err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != h.Sum32() {
+		return nil, ErrBadChecksum
+	}
+
+	return pairs, nil
+}
+
+// maxFieldLength bounds the length of a single key or value, so that a
+// corrupt length can't cause a huge allocation.
+const maxFieldLength = 1 << 30
+
+// teeByteReader reads from r, writing everything it reads into w.
+type teeByteReader struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+func (t *teeByteReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.w.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (t *teeByteReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(t)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	if n > maxFieldLength {
+		return nil, ErrCorruptDump
+	}
+
+	buf := make([]byte, n)
+	_, err = io.ReadFull(t.r, buf)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	t.w.Write(buf)
+	return buf, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedDump
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package kvl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const defaultBulkBatchSize = 10000
+
+// BulkOptions configures BulkLoad.
+type BulkOptions struct {
+	// BatchSize is the number of pairs written by each batch. Zero means
+	// 10000.
+	BatchSize int
+
+	// FailIfExists makes the load fail with a *KeyExistsError when it reaches
+	// a key that is already in the DB, or that appeared earlier in the load,
+	// instead of overwriting it.
+	FailIfExists bool
+
+	// Progress, if not nil, is sent the BulkStats after every batch.
+	Progress chan<- BulkStats
+}
+
+func (o *BulkOptions) withDefaults() BulkOptions {
+	var opts BulkOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBulkBatchSize
+	}
+	return opts
+}
+
+// BulkStats counts the pairs written by BulkLoad.
+type BulkStats struct {
+	Pairs   int64 // pairs written
+	Bytes   int64 // size of the keys and values written
+	Batches int
+}
+
+// ErrKeyExists matches every *KeyExistsError with errors.Is.
+var ErrKeyExists = errors.New("key already exists")
+
+// A KeyExistsError is returned by BulkLoad with FailIfExists set when it
+// reaches a key that already exists.
+type KeyExistsError struct {
+	Key []byte
+}
+
+func (e *KeyExistsError) Error() string {
+	return fmt.Sprintf("key %q already exists", e.Key)
+}
+
+func (e *KeyExistsError) Is(target error) bool {
+	return target == ErrKeyExists
+}
+
+// A PairSource is a stream of pairs, in any order, to be loaded by BulkLoad.
+// Next returns io.EOF after the last pair.
+type PairSource interface {
+	Next() (Pair, error)
+}
+
+type pairSlice []Pair
+
+// PairSlice returns a PairSource reading the given pairs.
+func PairSlice(pairs []Pair) PairSource {
+	s := pairSlice(pairs)
+	return &s
+}
+
+func (s *pairSlice) Next() (Pair, error) {
+	if len(*s) == 0 {
+		return Pair{}, io.EOF
+	}
+	p := (*s)[0]
+	*s = (*s)[1:]
+	return p, nil
+}
+
+// A BulkLoader is a DB that can write large numbers of pairs faster than
+// RunTx. Use BulkLoad to load pairs into any DB.
+type BulkLoader interface {
+	DB
+
+	// BulkLoad writes the pairs read from src in batches, as described by
+	// BulkLoad.
+	BulkLoad(src PairSource, opts *BulkOptions) (BulkStats, error)
+}
+
+// BulkLoad writes the pairs read from src into db, overwriting any existing
+// values. If a key appears more than once, its last value is kept.
+//
+// The load is not atomic: it is split into batches, each of which is written
+// atomically as if by a transaction. If the load fails, the batches already
+// written stay written, and the returned BulkStats count them.
+//
+// If db is a BulkLoader, its BulkLoad method is used. The backends in this
+// module check each pair against their Limits, but not the batches, so a
+// batch may be larger than a transaction could be. If db is not a
+// BulkLoader, each batch is written by a transaction.
+func BulkLoad(db DB, src PairSource, opts *BulkOptions) (BulkStats, error) {
+	if bdb, ok := db.(BulkLoader); ok {
+		return bdb.BulkLoad(src, opts)
+	}
+
+	failIfExists := opts != nil && opts.FailIfExists
+	return BulkBatches(src, opts, func(batch []Pair) error {
+		return db.RunTx(func(ctx Ctx) error {
+			for _, p := range batch {
+				if failIfExists {
+					_, err := ctx.Get(p.Key)
+					if err == nil {
+						return &KeyExistsError{p.Key}
+					}
+					if err != ErrNotFound {
+						return err
+					}
+				}
+
+				err := ctx.Set(p)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// BulkBatches does the work of a BulkLoad except for the writing: it reads
+// src in batches of opts.BatchSize pairs, sorts each batch by key (keeping
+// the order of equal keys), and passes it to write. It counts and reports the
+// batches write returns nil for, and stops at the first error.
+//
+// BulkLoader implementations use it to write each batch their own way.
+func BulkBatches(src PairSource, opts *BulkOptions, write func([]Pair) error) (BulkStats, error) {
+	o := opts.withDefaults()
+
+	var stats BulkStats
+	batch := make([]Pair, 0, o.BatchSize)
+	for {
+		batch = batch[:0]
+		var srcErr error
+		for len(batch) < o.BatchSize {
+			p, err := src.Next()
+			if err != nil {
+				srcErr = err
+				break
+			}
+			batch = append(batch, p)
+		}
+		if srcErr != nil && srcErr != io.EOF {
+			return stats, srcErr
+		}
+		if len(batch) == 0 {
+			return stats, nil
+		}
+
+		sort.SliceStable(batch, func(i, j int) bool {
+			return bytes.Compare(batch[i].Key, batch[j].Key) < 0
+		})
+
+		err := write(batch)
+		if err != nil {
+			return stats, err
+		}
+
+		for _, p := range batch {
+			stats.Pairs++
+			stats.Bytes += int64(len(p.Key) + len(p.Value))
+		}
+		stats.Batches++
+		if o.Progress != nil {
+			o.Progress <- stats
+		}
+
+		if srcErr == io.EOF {
+			return stats, nil
+		}
+	}
+}
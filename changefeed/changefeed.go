@@ -0,0 +1,509 @@
+// Package changefeed records the writes of every committed transaction into an
+// ordered log stored in the same database, so that caches, search indexes and
+// other consumers can follow the changes.
+//
+// A Feed stores its data in three keyspaces of the DB it wraps:
+//
+//	("data") + key         the data seen by transactions run on the Feed
+//	("log", seq)           the log entries, in commit order
+//	("consumers", name)    the acknowledged position of each consumer
+//
+// plus the last assigned sequence number under ("seq").
+//
+// Because every transaction that writes also updates the sequence number, all
+// writing transactions on a Feed conflict with each other. In-process
+// consumers of a ram DB that don't need a durable log can use
+// ram.DB.Subscribe instead.
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/keys"
+	"github.com/encryptio/kvl/tuple"
+)
+
+var ErrCorruptEntry = errors.New("changefeed: corrupt log entry")
+
+// errWaitDone stops the WatchLoop in Wait.
+var errWaitDone = errors.New("wait done")
+
+const trimBatch = 1000
+
+var (
+	dataPrefix      = tuple.MustAppend(nil, "data")
+	logPrefix       = tuple.MustAppend(nil, "log")
+	consumersPrefix = tuple.MustAppend(nil, "consumers")
+	seqKey          = tuple.MustAppend(nil, "seq")
+)
+
+// A Change is a single key written by a transaction.
+type Change struct {
+	Key, Value []byte
+	Deleted    bool
+}
+
+// An Entry is the set of keys written by one committed transaction, in
+// ascending key order.
+type Entry struct {
+	Seq     uint64
+	Time    time.Time
+	Changes []Change
+}
+
+// A Feed is a DB that logs the writes of every transaction it commits.
+type Feed struct {
+	db  kvl.DB
+	now func() time.Time
+}
+
+// New returns a Feed storing its data and log in db.
+//
+// Closing the Feed closes db.
+func New(db kvl.DB) *Feed {
+	return &Feed{db: db, now: time.Now}
+}
+
+func (f *Feed) RunTx(tx kvl.Tx) error {
+	return f.db.RunTx(func(ctx kvl.Ctx) error {
+		rec := &recordingCtx{
+			inner:   kvl.SubCtx(ctx, dataPrefix),
+			changes: make(map[string]Change),
+		}
+
+		err := tx(rec)
+		if err != nil || len(rec.changes) == 0 {
+			return err
+		}
+
+		return f.appendEntry(ctx, rec.entry())
+	})
+}
+
+func (f *Feed) RunReadTx(tx kvl.Tx) error {
+	return f.db.RunReadTx(func(ctx kvl.Ctx) error {
+		return tx(kvl.SubCtx(ctx, dataPrefix))
+	})
+}
+
+func (f *Feed) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	// through a SubDB, so that ChangeWatchResults report unprefixed keys
+	return kvl.SubDB(f.db, dataPrefix).WatchTx(tx)
+}
+
+// Capabilities reports the capabilities of the underlying DB, except
+// Snapshot, which a Feed does not support.
+func (f *Feed) Capabilities() kvl.Capabilities {
+	caps := kvl.CapabilitiesOf(f.db)
+	caps.Snapshot = false
+	return caps
+}
+
+func (f *Feed) Ping() error {
+	return kvl.Ping(f.db)
+}
+
+// Stats reports the Stats of the underlying DB, whose counts include the log.
+func (f *Feed) Stats() kvl.Stats {
+	return kvl.StatsOf(f.db)
+}
+
+func (f *Feed) Shutdown(ctx context.Context) error {
+	return kvl.Shutdown(ctx, f.db)
+}
+
+func (f *Feed) Close() {
+	f.db.Close()
+}
+
+func (f *Feed) appendEntry(ctx kvl.Ctx, e Entry) error {
+	seq, err := getUint(ctx, seqKey)
+	if err != nil {
+		return err
+	}
+	seq++
+
+	err = ctx.Set(kvl.Pair{seqKey, tuple.MustAppend(nil, seq)})
+	if err != nil {
+		return err
+	}
+
+	e.Time = f.now()
+	return ctx.Set(kvl.Pair{logKey(seq), encodeEntry(e)})
+}
+
+// Read returns up to limit log entries with sequence numbers greater than
+// after, in order. A limit of zero means no limit.
+func (f *Feed) Read(after uint64, limit int) ([]Entry, error) {
+	var entries []Entry
+	err := f.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		entries, err = readEntries(ctx, after, limit)
+		return err
+	})
+	return entries, err
+}
+
+// Latest returns the sequence number of the newest log entry, or zero if
+// nothing has been written yet. It is still returned after the entry has been
+// trimmed.
+func (f *Feed) Latest() (uint64, error) {
+	var seq uint64
+	err := f.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		seq, err = getUint(ctx, seqKey)
+		return err
+	})
+	return seq, err
+}
+
+// Position returns the last sequence number acknowledged by the named
+// consumer, or zero if it has not acknowledged any.
+func (f *Feed) Position(consumer string) (uint64, error) {
+	var seq uint64
+	err := f.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		seq, err = getUint(ctx, consumerKey(consumer))
+		return err
+	})
+	return seq, err
+}
+
+// Ack records that the named consumer has processed all entries up to and
+// including seq. Positions never move backwards; acknowledging an older
+// sequence number than the current position does nothing.
+func (f *Feed) Ack(consumer string, seq uint64) error {
+	key := consumerKey(consumer)
+	return f.db.RunTx(func(ctx kvl.Ctx) error {
+		pos, err := getUint(ctx, key)
+		if err != nil {
+			return err
+		}
+		if seq <= pos {
+			return nil
+		}
+		return ctx.Set(kvl.Pair{key, tuple.MustAppend(nil, seq)})
+	})
+}
+
+// RemoveConsumer forgets the position of the named consumer, so that it no
+// longer holds back Trim.
+func (f *Feed) RemoveConsumer(consumer string) error {
+	return f.db.RunTx(func(ctx kvl.Ctx) error {
+		err := ctx.Delete(consumerKey(consumer))
+		if err == kvl.ErrNotFound {
+			err = nil
+		}
+		return err
+	})
+}
+
+// Consumers returns the positions of all consumers, by name.
+func (f *Feed) Consumers() (map[string]uint64, error) {
+	var positions map[string]uint64
+	err := f.db.RunReadTx(func(ctx kvl.Ctx) error {
+		positions = make(map[string]uint64)
+
+		pairs, err := kvl.SubCtx(ctx, consumersPrefix).Range(kvl.RangeQuery{})
+		if err != nil {
+			return err
+		}
+
+		for _, p := range pairs {
+			var name string
+			var seq uint64
+			err = tuple.UnpackInto(p.Key, &name)
+			if err != nil {
+				return err
+			}
+			err = tuple.UnpackInto(p.Value, &seq)
+			if err != nil {
+				return err
+			}
+			positions[name] = seq
+		}
+		return nil
+	})
+	return positions, err
+}
+
+// Trim deletes the log entries that every consumer has acknowledged, and
+// returns how many were deleted. If there are no consumers, nothing is
+// deleted.
+//
+// Entries are deleted in batches of separate transactions, so a Trim that
+// fails partway may have deleted some of them.
+func (f *Feed) Trim() (int, error) {
+	positions, err := f.Consumers()
+	if err != nil || len(positions) == 0 {
+		return 0, err
+	}
+
+	var upTo uint64
+	first := true
+	for _, seq := range positions {
+		if first || seq < upTo {
+			upTo = seq
+			first = false
+		}
+	}
+
+	total := 0
+	for {
+		var deleted int
+		err := f.db.RunTx(func(ctx kvl.Ctx) error {
+			deleted = 0
+
+			pairs, err := ctx.Range(kvl.RangeQuery{
+				Low:   logPrefix,
+				High:  logKey(upTo + 1),
+				Limit: trimBatch,
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, p := range pairs {
+				err = ctx.Delete(p.Key)
+				if err != nil {
+					return err
+				}
+			}
+			deleted = len(pairs)
+			return nil
+		})
+		total += deleted
+		if err != nil || deleted < trimBatch {
+			return total, err
+		}
+	}
+}
+
+// Follow calls fn with every log entry after the named consumer's position,
+// in order, acknowledging each one after fn returns nil. When it runs out of
+// entries, it waits for more using kvl.WatchLoop.
+//
+// Follow returns when ctx is done, when fn returns an error (without
+// acknowledging that entry), or when the Feed's DB does not support watches
+// or is closed.
+func (f *Feed) Follow(ctx context.Context, consumer string, fn func(Entry) error) error {
+	pos, err := f.Position(consumer)
+	if err != nil {
+		return err
+	}
+
+	var entries []Entry
+	tx := func(c kvl.Ctx) error {
+		// every append changes seqKey, so reading it makes the watch fire on
+		// new entries even when the range read below hits its limit
+		_, err := getUint(c, seqKey)
+		if err != nil {
+			return err
+		}
+
+		entries, err = readEntries(c, pos, trimBatch)
+		return err
+	}
+
+	return kvl.WatchLoop(ctx, f.db, tx, func() error {
+		for {
+			for _, e := range entries {
+				err := fn(e)
+				if err != nil {
+					return err
+				}
+
+				err = f.Ack(consumer, e.Seq)
+				if err != nil {
+					return err
+				}
+				pos = e.Seq
+			}
+
+			if len(entries) < trimBatch {
+				return nil
+			}
+
+			var err error
+			entries, err = f.Read(pos, trimBatch)
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// Wait blocks until the log has an entry with a sequence number greater than
+// after, or until ctx is done. It returns an error if the Feed's DB does not
+// support watches, and kvl.ErrClosed once it is closed.
+func (f *Feed) Wait(ctx context.Context, after uint64) error {
+	var latest uint64
+	tx := func(c kvl.Ctx) error {
+		var err error
+		latest, err = getUint(c, seqKey)
+		return err
+	}
+
+	err := kvl.WatchLoop(ctx, f.db, tx, func() error {
+		if latest > after {
+			return errWaitDone
+		}
+		return nil
+	})
+	if err == errWaitDone {
+		err = nil
+	}
+	return err
+}
+
+func readEntries(ctx kvl.Ctx, after uint64, limit int) ([]Entry, error) {
+	pairs, err := ctx.Range(kvl.RangeQuery{
+		Low:   logKey(after + 1),
+		High:  keys.PrefixNext(logPrefix),
+		Limit: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(pairs))
+	for _, p := range pairs {
+		var seq uint64
+		err = tuple.UnpackInto(p.Key[len(logPrefix):], &seq)
+		if err != nil {
+			return nil, ErrCorruptEntry
+		}
+
+		e, err := decodeEntry(p.Value)
+		if err != nil {
+			return nil, err
+		}
+		e.Seq = seq
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func logKey(seq uint64) []byte {
+	return tuple.MustAppend(append([]byte(nil), logPrefix...), seq)
+}
+
+func consumerKey(name string) []byte {
+	return tuple.MustAppend(append([]byte(nil), consumersPrefix...), name)
+}
+
+// getUint reads a tuple-encoded uint64, returning zero if the key is missing.
+func getUint(ctx kvl.Ctx, key []byte) (uint64, error) {
+	p, err := ctx.Get(key)
+	if err == kvl.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	err = tuple.UnpackInto(p.Value, &v)
+	return v, err
+}
+
+// encodeEntry encodes the time and changes of an entry as a tuple of
+// (unix nanoseconds, then key, deleted, value for each change.)
+func encodeEntry(e Entry) []byte {
+	t := tuple.MustAppend(nil, e.Time.UnixNano())
+	for _, c := range e.Changes {
+		t = tuple.MustAppend(t, c.Key, c.Deleted, c.Value)
+	}
+	return t
+}
+
+func decodeEntry(t []byte) (Entry, error) {
+	var e Entry
+
+	var nanos int64
+	t, err := tuple.UnpackIntoPartial(t, &nanos)
+	if err != nil {
+		return e, ErrCorruptEntry
+	}
+	e.Time = time.Unix(0, nanos)
+
+	for len(t) > 0 {
+		var c Change
+		t, err = tuple.UnpackIntoPartial(t, &c.Key, &c.Deleted, &c.Value)
+		if err != nil {
+			return e, ErrCorruptEntry
+		}
+		if c.Deleted {
+			c.Value = nil
+		}
+		e.Changes = append(e.Changes, c)
+	}
+
+	return e, nil
+}
+
+// recordingCtx records the writes made through it.
+type recordingCtx struct {
+	inner   kvl.Ctx
+	changes map[string]Change
+}
+
+func (c *recordingCtx) TxInfo() kvl.TxInfo {
+	info, _ := kvl.TxInfoOf(c.inner)
+	return info
+}
+
+func (c *recordingCtx) TxSize() kvl.TxSize {
+	size, _ := kvl.TxSizeOf(c.inner)
+	return size
+}
+
+func (c *recordingCtx) Get(key []byte) (kvl.Pair, error) {
+	return c.inner.Get(key)
+}
+
+func (c *recordingCtx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
+	return c.inner.Range(query)
+}
+
+func (c *recordingCtx) Set(p kvl.Pair) error {
+	err := c.inner.Set(p)
+	if err != nil {
+		return err
+	}
+
+	c.changes[string(p.Key)] = Change{
+		Key:   append([]byte(nil), p.Key...),
+		Value: append([]byte{}, p.Value...),
+	}
+	return nil
+}
+
+func (c *recordingCtx) Delete(key []byte) error {
+	err := c.inner.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	c.changes[string(key)] = Change{
+		Key:     append([]byte(nil), key...),
+		Deleted: true,
+	}
+	return nil
+}
+
+func (c *recordingCtx) entry() Entry {
+	changes := make([]Change, 0, len(c.changes))
+	for _, ch := range c.changes {
+		changes = append(changes, ch)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Key, changes[j].Key) < 0
+	})
+	return Entry{Changes: changes}
+}
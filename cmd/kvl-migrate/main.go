@@ -0,0 +1,121 @@
+// Command kvl-migrate copies the contents of one kvl database into another.
+//
+// Databases are given as backend:dsn, for example "bolt:/var/lib/app.db" or
+// "postgresql:postgres://localhost/app". Usage:
+//
+//	kvl-migrate -from bolt:old.db -to postgresql:postgres://localhost/app -verify
+//
+// The copy is made in chunks and can be resumed with -resume, using the hex key
+// printed when a copy fails. With -catchup, a second pass copies the writes
+// made to the source during the first one; stop writers before it starts.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/migrate"
+
+	_ "github.com/encryptio/kvl/backend/bolt"
+	_ "github.com/encryptio/kvl/backend/psql"
+	_ "github.com/encryptio/kvl/backend/ram"
+	_ "github.com/encryptio/kvl/backend/remote"
+)
+
+func openDB(spec string) (kvl.DB, error) {
+	i := strings.IndexByte(spec, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("database %q is not of the form backend:dsn", spec)
+	}
+	return kvl.Open(spec[:i], spec[i+1:])
+}
+
+func main() {
+	from := flag.String("from", "", "source database, as backend:dsn")
+	to := flag.String("to", "", "destination database, as backend:dsn")
+	chunk := flag.Int("chunk", 1000, "pairs per transaction")
+	resume := flag.String("resume", "", "hex key to resume an interrupted copy from")
+	catchup := flag.Bool("catchup", false, "run a second pass after the copy")
+	verify := flag.Bool("verify", false, "compare checksums of both databases after copying")
+	quiet := flag.Bool("quiet", false, "don't print progress")
+	flag.Parse()
+
+	if *from == "" || *to == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	start, err := hex.DecodeString(*resume)
+	if err != nil {
+		log.Fatalf("bad -resume key: %v", err)
+	}
+
+	err = run(*from, *to, &migrate.Options{ChunkSize: *chunk, Start: start}, *catchup, *verify, *quiet)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run opens both databases and migrates between them, closing them before it
+// returns.
+func run(from, to string, opts *migrate.Options, catchup, verify, quiet bool) error {
+	src, err := openDB(from)
+	if err != nil {
+		return fmt.Errorf("couldn't open source: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := openDB(to)
+	if err != nil {
+		return fmt.Errorf("couldn't open destination: %v", err)
+	}
+	defer dst.Close()
+
+	return migrateDB(dst, src, opts, catchup, verify, quiet)
+}
+
+func migrateDB(dst, src kvl.DB, opts *migrate.Options, catchup, verify, quiet bool) error {
+	passes := []string{"copy"}
+	if catchup {
+		passes = append(passes, "catch-up")
+	}
+
+	for _, pass := range passes {
+		progress := make(chan migrate.Stats)
+		done := make(chan struct{})
+		go func() {
+			for stats := range progress {
+				if !quiet {
+					log.Printf("%v: %v", pass, stats)
+				}
+			}
+			close(done)
+		}()
+
+		stats, err := migrate.Copy(dst, src, opts, progress)
+		close(progress)
+		<-done
+		if err != nil {
+			return fmt.Errorf("%v failed (resume with -resume %x): %v", pass, stats.Resume, err)
+		}
+		log.Printf("%v done: %v", pass, stats)
+
+		// later passes start from the beginning
+		opts.Start = nil
+	}
+
+	if verify {
+		err := migrate.Verify(dst, src, &migrate.Options{ChunkSize: opts.ChunkSize})
+		if err != nil {
+			return err
+		}
+		log.Printf("verified: checksums match")
+	}
+
+	return nil
+}
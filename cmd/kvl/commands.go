@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/keys"
+)
+
+const countChunkSize = 1000
+
+type shell struct {
+	db           kvl.DB
+	keys, values format
+	out          io.Writer
+}
+
+var errUsage = errors.New("wrong arguments; try help")
+
+const helpText = `commands:
+  get KEY
+  set KEY VALUE
+  delete KEY
+  range [-desc] [-limit N] [LOW [HIGH]]
+  prefix [-desc] [-limit N] PREFIX
+  count [-prefix] [LOW [HIGH]]
+  help
+  quit
+`
+
+// run runs a single command.
+func (s *shell) run(args []string) error {
+	switch args[0] {
+	case "get":
+		return s.get(args[1:])
+	case "set":
+		return s.set(args[1:])
+	case "delete", "del":
+		return s.delete(args[1:])
+	case "range":
+		return s.rangeCmd(args[1:], false)
+	case "prefix":
+		return s.rangeCmd(args[1:], true)
+	case "count":
+		return s.count(args[1:])
+	case "help":
+		_, err := io.WriteString(s.out, helpText)
+		return err
+	default:
+		return fmt.Errorf("unknown command %q; try help", args[0])
+	}
+}
+
+func (s *shell) parseKeys(args []string) ([][]byte, error) {
+	parsed := make([][]byte, len(args))
+	for i, a := range args {
+		var err error
+		parsed[i], err = s.keys.parse(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+func (s *shell) printPair(p kvl.Pair) {
+	fmt.Fprintf(s.out, "%v\t%v\n", s.keys.render(p.Key), s.values.render(p.Value))
+}
+
+func (s *shell) get(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	key, err := s.keys.parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	var p kvl.Pair
+	err = s.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		p, err = ctx.Get(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(s.out, s.values.render(p.Value))
+	return nil
+}
+
+func (s *shell) set(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	key, err := s.keys.parse(args[0])
+	if err != nil {
+		return err
+	}
+	value, err := s.values.parse(args[1])
+	if err != nil {
+		return err
+	}
+
+	return s.db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{key, value})
+	})
+}
+
+func (s *shell) delete(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	key, err := s.keys.parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	return s.db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Delete(key)
+	})
+}
+
+func (s *shell) rangeCmd(args []string, prefix bool) error {
+	flags := flag.NewFlagSet("range", flag.ContinueOnError)
+	flags.SetOutput(s.out)
+	desc := flags.Bool("desc", false, "descending order")
+	limit := flags.Int("limit", 0, "maximum number of pairs")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	bounds, err := s.parseKeys(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	query := kvl.RangeQuery{Limit: *limit, Descending: *desc}
+	if prefix {
+		if len(bounds) != 1 {
+			return errUsage
+		}
+		query.Low, query.High = keys.PrefixRange(bounds[0])
+	} else {
+		if len(bounds) > 2 {
+			return errUsage
+		}
+		if len(bounds) > 0 {
+			query.Low = bounds[0]
+		}
+		if len(bounds) > 1 {
+			query.High = bounds[1]
+		}
+	}
+
+	var pairs []kvl.Pair
+	err = s.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		pairs, err = ctx.Range(query)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pairs {
+		s.printPair(p)
+	}
+	return nil
+}
+
+func (s *shell) count(args []string) error {
+	flags := flag.NewFlagSet("count", flag.ContinueOnError)
+	flags.SetOutput(s.out)
+	prefix := flags.Bool("prefix", false, "count the keys with the prefix LOW")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	bounds, err := s.parseKeys(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	var low, high []byte
+	switch {
+	case *prefix && len(bounds) == 1:
+		low, high = keys.PrefixRange(bounds[0])
+	case !*prefix && len(bounds) <= 2:
+		if len(bounds) > 0 {
+			low = bounds[0]
+		}
+		if len(bounds) > 1 {
+			high = bounds[1]
+		}
+	default:
+		return errUsage
+	}
+
+	// counted in chunks of separate transactions, so the total is not from a
+	// single snapshot of a changing database
+	total := 0
+	for {
+		var pairs []kvl.Pair
+		err = s.db.RunReadTx(func(ctx kvl.Ctx) error {
+			var err error
+			pairs, err = ctx.Range(kvl.RangeQuery{Low: low, High: high, Limit: countChunkSize})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		total += len(pairs)
+		if len(pairs) < countChunkSize {
+			break
+		}
+		low = keys.Successor(pairs[len(pairs)-1].Key)
+	}
+
+	fmt.Fprintln(s.out, total)
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/encryptio/kvl/tuple"
+)
+
+// A format converts keys and values between bytes and their text form.
+type format int
+
+const (
+	formatRaw format = iota
+	formatHex
+	formatTuple
+)
+
+func parseFormat(s string) (format, error) {
+	switch s {
+	case "raw":
+		return formatRaw, nil
+	case "hex":
+		return formatHex, nil
+	case "tuple":
+		return formatTuple, nil
+	default:
+		return 0, fmt.Errorf("unknown format %q (want raw, hex or tuple)", s)
+	}
+}
+
+// parse converts text to bytes. Tuples are written as comma separated
+// elements, each a Go string literal, an integer, true, false, nil, or
+// x followed by a quoted hex string for a byte string, e.g.
+//
+//	"users",42,x"00ff"
+func (f format) parse(s string) ([]byte, error) {
+	switch f {
+	case formatHex:
+		return hex.DecodeString(s)
+	case formatTuple:
+		return parseTuple(s)
+	default:
+		return []byte(s), nil
+	}
+}
+
+// render converts bytes to text. Data that isn't a valid tuple is rendered in
+// hex with a "!" prefix by the tuple format.
+func (f format) render(b []byte) string {
+	switch f {
+	case formatHex:
+		return hex.EncodeToString(b)
+	case formatTuple:
+		s, err := renderTuple(b)
+		if err != nil {
+			return "!" + hex.EncodeToString(b)
+		}
+		return s
+	default:
+		return string(b)
+	}
+}
+
+func parseTuple(s string) ([]byte, error) {
+	elements, err := splitTuple(s)
+	if err != nil {
+		return nil, err
+	}
+
+	t := []byte{}
+	for _, e := range elements {
+		v, err := parseElement(e)
+		if err != nil {
+			return nil, err
+		}
+		t, err = tuple.Append(t, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func parseElement(e string) (interface{}, error) {
+	switch {
+	case e == "nil":
+		return nil, nil
+	case e == "true":
+		return true, nil
+	case e == "false":
+		return false, nil
+	case strings.HasPrefix(e, `x"`):
+		s, err := strconv.Unquote(e[1:])
+		if err != nil {
+			return nil, fmt.Errorf("bad tuple element %v: %v", e, err)
+		}
+		return hex.DecodeString(s)
+	case strings.HasPrefix(e, `"`):
+		s, err := strconv.Unquote(e)
+		if err != nil {
+			return nil, fmt.Errorf("bad tuple element %v: %v", e, err)
+		}
+		return s, nil
+	default:
+		n, ok := new(big.Int).SetString(e, 10)
+		if !ok {
+			return nil, fmt.Errorf("bad tuple element %v", e)
+		}
+		if n.IsInt64() {
+			return n.Int64(), nil
+		}
+		return n, nil
+	}
+}
+
+// splitTuple splits s at the commas outside of quoted strings.
+func splitTuple(s string) ([]string, error) {
+	var elements []string
+	if strings.TrimSpace(s) == "" {
+		return elements, nil
+	}
+
+	start := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == ',':
+			elements = append(elements, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated string in tuple")
+	}
+	return append(elements, strings.TrimSpace(s[start:])), nil
+}
+
+func renderTuple(t []byte) (string, error) {
+	var elements []string
+	for len(t) > 0 {
+		var v interface{}
+		var err error
+		t, err = tuple.UnpackIntoPartial(t, &v)
+		if err != nil {
+			return "", err
+		}
+
+		switch v := v.(type) {
+		case nil:
+			elements = append(elements, "nil")
+		case []byte:
+			elements = append(elements, strconv.Quote(string(v)))
+		default:
+			elements = append(elements, fmt.Sprint(v))
+		}
+	}
+	return strings.Join(elements, ","), nil
+}
+
+// splitWords splits a REPL line into words like a shell does: words are
+// separated by spaces, single quotes quote literally, and double quotes quote
+// with backslash escapes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
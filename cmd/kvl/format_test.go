@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/encryptio/kvl/tuple"
+)
+
+func TestTupleFormat(t *testing.T) {
+	tests := []struct {
+		In    string
+		Tuple []byte
+		Out   string
+	}{
+		{``, []byte{}, ``},
+		{`"users", 42`, tuple.MustAppend(nil, "users", 42), `"users",42`},
+		{`"a,\"b",-7,true,false,nil`, tuple.MustAppend(nil, "a,\"b", -7, true, false, nil), `"a,\"b",-7,true,false,nil`},
+		{`x"00ff"`, tuple.MustAppend(nil, []byte{0, 0xff}), `"\x00\xff"`},
+	}
+
+	for _, test := range tests {
+		got, err := formatTuple.parse(test.In)
+		if err != nil {
+			t.Errorf("parse(%q) returned error %v", test.In, err)
+			continue
+		}
+		if !bytes.Equal(got, test.Tuple) {
+			t.Errorf("parse(%q) = %x, wanted %x", test.In, got, test.Tuple)
+		}
+		if out := formatTuple.render(got); out != test.Out {
+			t.Errorf("render(%x) = %q, wanted %q", got, out, test.Out)
+		}
+	}
+
+	if out := formatTuple.render([]byte{0xff}); out != "!ff" {
+		t.Errorf("render of invalid tuple = %q, wanted %q", out, "!ff")
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		In  string
+		Out []string
+	}{
+		{`get key`, []string{"get", "key"}},
+		{`  set  "a b"  'c "d"' `, []string{"set", "a b", `c "d"`}},
+		{`set "x\"y" a\ b`, []string{"set", `x"y`, "a b"}},
+		{``, nil},
+	}
+
+	for _, test := range tests {
+		got, err := splitWords(test.In)
+		if err != nil {
+			t.Errorf("splitWords(%q) returned error %v", test.In, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.Out) {
+			t.Errorf("splitWords(%q) = %q, wanted %q", test.In, got, test.Out)
+		}
+	}
+
+	_, err := splitWords(`get "key`)
+	if err == nil {
+		t.Errorf("splitWords accepted an unterminated quote")
+	}
+}
@@ -0,0 +1,128 @@
+// Command kvl inspects and edits kvl databases.
+//
+// Usage:
+//
+//	kvl [flags] backend dsn [command [args...]]
+//
+// The database is opened with kvl.Open. Without a command, kvl reads commands
+// from standard input, one per line. Commands are:
+//
+//	get KEY
+//	set KEY VALUE
+//	delete KEY
+//	range [-desc] [-limit N] [LOW [HIGH]]
+//	prefix [-desc] [-limit N] PREFIX
+//	count [-prefix] [LOW [HIGH]]
+//	help
+//
+// Keys and values are parsed and printed in the formats given by the -keys and
+// -values flags: raw bytes, hex, or tuples. An empty HIGH is unbounded.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/encryptio/kvl"
+
+	_ "github.com/encryptio/kvl/backend/bolt"
+	_ "github.com/encryptio/kvl/backend/psql"
+	_ "github.com/encryptio/kvl/backend/ram"
+	_ "github.com/encryptio/kvl/backend/remote"
+)
+
+func main() {
+	keyFormat := flag.String("keys", "raw", "key format: raw, hex or tuple")
+	valueFormat := flag.String("values", "raw", "value format: raw, hex or tuple")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %v [flags] backend dsn [command [args...]]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "backends:\n")
+		for _, b := range kvl.Backends() {
+			fmt.Fprintf(os.Stderr, "  %-12v %v\n", b.Name, b.Description)
+		}
+	}
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	kf, err := parseFormat(*keyFormat)
+	if err != nil {
+		fatal(err)
+	}
+	vf, err := parseFormat(*valueFormat)
+	if err != nil {
+		fatal(err)
+	}
+
+	db, err := kvl.Open(flag.Arg(0), flag.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	s := &shell{db: db, keys: kf, values: vf, out: os.Stdout}
+	args := flag.Args()[2:]
+	if len(args) > 0 {
+		err = s.run(args)
+	} else {
+		err = s.repl(os.Stdin)
+	}
+	db.Close()
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "kvl: %v\n", err)
+	os.Exit(1)
+}
+
+// repl runs the commands read from r until it ends. Errors from commands are
+// printed and don't stop it.
+func (s *shell) repl(r io.Reader) error {
+	prompt := isTerminal(os.Stdin)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+
+	for {
+		if prompt {
+			fmt.Fprint(s.out, "kvl> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		words, err := splitWords(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "quit" || words[0] == "exit" {
+			return nil
+		}
+
+		err = s.run(words)
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+	if prompt {
+		fmt.Fprintln(s.out)
+	}
+	return scanner.Err()
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
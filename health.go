@@ -0,0 +1,88 @@
+package kvl
+
+import (
+	"context"
+	"time"
+)
+
+// CloseTimeout is how long the Close method of a ShutdownDB waits for running
+// transactions to finish.
+const CloseTimeout = 10 * time.Second
+
+// A PingDB is a DB that can check its connection to the underlying storage.
+type PingDB interface {
+	DB
+
+	// Ping returns an error if the DB is closed or cannot reach its storage.
+	Ping() error
+}
+
+// Ping calls db.Ping if db is a PingDB, and otherwise runs an empty read-only
+// transaction.
+func Ping(db DB) error {
+	if pdb, ok := db.(PingDB); ok {
+		return pdb.Ping()
+	}
+	return db.RunReadTx(func(Ctx) error { return nil })
+}
+
+// Stats is a report on the state of a DB. Counts that the DB cannot report are
+// -1.
+type Stats struct {
+	// Keys and Bytes estimate the number of pairs stored and the total size of
+	// their keys and values. The estimates may be taken from the storage's own
+	// bookkeeping and include some overhead.
+	Keys  int64
+	Bytes int64
+
+	// Transactions is the number of transactions running, including watch
+	// transactions that have not returned yet.
+	Transactions int
+
+	// Watches is the number of watches that are waiting for a change.
+	Watches int
+
+	// Backend holds backend-specific statistics, such as a bolt.Stats or a
+	// sql.DBStats, or nil.
+	Backend interface{}
+}
+
+// A StatsDB is a DB that can report Stats.
+type StatsDB interface {
+	DB
+
+	Stats() Stats
+}
+
+// StatsOf returns db.Stats() if db is a StatsDB, and Stats with every count
+// unknown otherwise.
+func StatsOf(db DB) Stats {
+	if sdb, ok := db.(StatsDB); ok {
+		return sdb.Stats()
+	}
+	return Stats{Keys: -1, Bytes: -1, Transactions: -1, Watches: -1}
+}
+
+// A ShutdownDB is a DB that can close gracefully. Its Close method is Shutdown
+// with a timeout of CloseTimeout.
+type ShutdownDB interface {
+	DB
+
+	// Shutdown closes the DB. New transactions and watches fail with ErrClosed
+	// at once, and the Error methods of open watches return ErrClosed. Shutdown
+	// waits for running transactions to finish until ctx is done, and then
+	// closes the underlying storage, returning ctx.Err() if it didn't wait for
+	// every transaction.
+	//
+	// Shutdown returns ErrClosed if the DB was already closed.
+	Shutdown(ctx context.Context) error
+}
+
+// Shutdown calls db.Shutdown if db is a ShutdownDB, and db.Close otherwise.
+func Shutdown(ctx context.Context, db DB) error {
+	if sdb, ok := db.(ShutdownDB); ok {
+		return sdb.Shutdown(ctx)
+	}
+	db.Close()
+	return nil
+}
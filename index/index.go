@@ -67,6 +67,16 @@ func (w ctxWrap) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
 	return w.dataCtx.Range(query)
 }
 
+func (w ctxWrap) TxInfo() kvl.TxInfo {
+	info, _ := kvl.TxInfoOf(w.dataCtx)
+	return info
+}
+
+func (w ctxWrap) TxSize() kvl.TxSize {
+	size, _ := kvl.TxSizeOf(w.dataCtx)
+	return size
+}
+
 func (w ctxWrap) Set(newP kvl.Pair) error {
 	oldP, err := w.dataCtx.Get(newP.Key)
 	if err != nil && err != kvl.ErrNotFound {
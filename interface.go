@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
 	ErrNotFound         = errors.New("key not found")
 	ErrReadOnlyTx       = errors.New("transaction not opened for writing")
 	ErrWatchUnsupported = errors.New("watch operations not supported on this database")
+
+	ErrSnapshotUnsupported = errors.New("snapshot transactions not supported on this database")
+
+	ErrClosed = errors.New("database closed")
 )
 
 // A Tx is a serializable transactional operation.
@@ -60,7 +65,7 @@ type DB interface {
 	WatchTx(Tx) (WatchResult, error)
 
 	// Close the DB. Concurrently executing transactions' and watches' behavior is
-	// not defined.
+	// not defined, unless the DB is a ShutdownDB; see Shutdown.
 	//
 	// The DB should not be used after Close is called.
 	Close()
@@ -88,6 +93,99 @@ type WatchResult interface {
 	Close()
 }
 
+// A ChangeWatchResult is a WatchResult that can report which changes closed
+// its Done channel. Some backends return one from WatchTx; use a type
+// assertion to check.
+type ChangeWatchResult interface {
+	WatchResult
+
+	// Changes returns the keys read by the watched Tx that were written by the
+	// commit that closed the Done channel, in ascending order, and the version
+	// of the database that commit created. Versions increase with every commit
+	// and are only comparable within a single DB.
+	//
+	// ok is false if the Done channel is not closed yet, or was closed for any
+	// other reason (such as an error or a call to Close.)
+	Changes() (keys [][]byte, version uint64, ok bool)
+}
+
+// A SnapshotDB is a DB that can run a read-only transaction against a
+// consistent snapshot of the database without ever retrying it, so that the
+// Tx may have side effects such as streaming its results to a file. Some
+// backends return one; use RunSnapshotTx to check.
+type SnapshotDB interface {
+	DB
+
+	// RunSnapshotTx runs a read-only transaction exactly once. Attempted write
+	// operations will return ErrReadOnlyTx.
+	RunSnapshotTx(Tx) error
+}
+
+// RunSnapshotTx calls db.RunSnapshotTx if db is a SnapshotDB, and returns
+// ErrSnapshotUnsupported otherwise.
+func RunSnapshotTx(db DB, tx Tx) error {
+	if sdb, ok := db.(SnapshotDB); ok {
+		return sdb.RunSnapshotTx(tx)
+	}
+	return ErrSnapshotUnsupported
+}
+
+// Capabilities describes the optional features of a DB, so that callers can
+// pick a strategy up front instead of calling and checking for errors such as
+// ErrWatchUnsupported.
+//
+// StreamingRange, AtomicOps and Savepoints describe features that no DB in
+// this module has yet, so they are always false.
+type Capabilities struct {
+	// Watch is true if WatchTx is supported.
+	Watch bool
+
+	// ChangeWatch is true if WatchTx returns ChangeWatchResults.
+	ChangeWatch bool
+
+	// Snapshot is true if RunSnapshotTx is supported.
+	Snapshot bool
+
+	// Durable is true if committed transactions are written to persistent
+	// storage and survive the process exiting.
+	Durable bool
+
+	// MultiProcess is true if several processes may open and write to the
+	// same database at once.
+	MultiProcess bool
+
+	// StreamingRange is true if ranges can be read incrementally, without
+	// holding all of their pairs in memory at once.
+	StreamingRange bool
+
+	// AtomicOps is true if values can be modified in place (such as by adding
+	// to a counter) without reading them in the transaction.
+	AtomicOps bool
+
+	// Savepoints is true if part of a transaction can be rolled back without
+	// aborting all of it.
+	Savepoints bool
+}
+
+// A CapabilitiesDB is a DB that can describe its optional features. Backends
+// and wrappers implement it; use CapabilitiesOf to query any DB.
+type CapabilitiesDB interface {
+	DB
+
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns db.Capabilities() if db is a CapabilitiesDB.
+// Otherwise, only the features that can be found by type assertion (such as
+// Snapshot) are reported.
+func CapabilitiesOf(db DB) Capabilities {
+	if cdb, ok := db.(CapabilitiesDB); ok {
+		return cdb.Capabilities()
+	}
+	_, snapshot := db.(SnapshotDB)
+	return Capabilities{Snapshot: snapshot}
+}
+
 type Pair struct {
 	Key, Value []byte
 }
@@ -116,3 +214,43 @@ type Ctx interface {
 	Set(p Pair) error
 	Delete(key []byte) error
 }
+
+// TxInfo describes the transaction a Ctx belongs to.
+type TxInfo struct {
+	// ID identifies the transaction among those run on the same DB. It stays
+	// the same when the Tx is retried.
+	ID uint64
+
+	// Attempt is 1 the first time the Tx is called, and counts up each time it
+	// is retried.
+	Attempt int
+
+	ReadOnly bool
+
+	// Start is when the first attempt started.
+	Start time.Time
+
+	// ReadVersion is the version of the database that the attempt reads, if
+	// HasReadVersion is set. It is comparable with the versions reported by
+	// ChangeWatchResult.Changes.
+	ReadVersion    uint64
+	HasReadVersion bool
+}
+
+// A TxInfoCtx is a Ctx that can describe its transaction. Use TxInfoOf to
+// query any Ctx.
+type TxInfoCtx interface {
+	Ctx
+
+	TxInfo() TxInfo
+}
+
+// TxInfoOf returns ctx.TxInfo() if ctx is a TxInfoCtx. ok is false if it is
+// not, or if it wraps a Ctx that is not and so returns a TxInfo with a zero
+// Attempt.
+func TxInfoOf(ctx Ctx) (info TxInfo, ok bool) {
+	if ictx, ok := ctx.(TxInfoCtx); ok {
+		info = ictx.TxInfo()
+	}
+	return info, info.Attempt > 0
+}
@@ -20,6 +20,15 @@ func LexNext(key []byte) []byte {
 	return n
 }
 
+// Successor returns the smallest key greater than key, which is key followed
+// by a zero byte. Unlike LexNext, no key falls between the two, so it is the
+// low end of a range query continuing after key.
+func Successor(key []byte) []byte {
+	n := make([]byte, len(key)+1)
+	copy(n, key)
+	return n
+}
+
 func PrefixNext(key []byte) []byte {
 	for i := len(key) - 1; i >= 0; i-- {
 		if key[i] != 0xFF {
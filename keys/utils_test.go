@@ -22,6 +22,23 @@ func TestLexNext(t *testing.T) {
 	}
 }
 
+func TestSuccessor(t *testing.T) {
+	tests := []struct {
+		In  []byte
+		Out []byte
+	}{
+		{nil, []byte{0x00}},
+		{[]byte{4}, []byte{4, 0x00}},
+		{[]byte{4, 0xFF}, []byte{4, 0xFF, 0x00}},
+	}
+
+	for _, test := range tests {
+		if !bytes.Equal(Successor(test.In), test.Out) {
+			t.Errorf("Successor(%v) = %v, wanted %v", test.In, Successor(test.In), test.Out)
+		}
+	}
+}
+
 func TestPrefixNext(t *testing.T) {
 	tests := []struct {
 		In  []byte
@@ -1,6 +1,7 @@
 package kvldebug
 
 import (
+	"context"
 	"log"
 
 	"github.com/encryptio/kvl"
@@ -42,6 +43,42 @@ func (l *LoggingDB) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
 	})
 }
 
+func (l *LoggingDB) RunSnapshotTx(tx kvl.Tx) error {
+	return kvl.RunSnapshotTx(l.Inner, func(ctx kvl.Ctx) (err error) {
+		logCtx := &LoggingCtx{ctx}
+		log.Printf("%p.RunSnapshotTx(%p) starting as %p", l, tx, ctx)
+		defer log.Printf("%p.RunSnapshotTx(%p) returning %v", l, tx, err)
+		err = tx(logCtx)
+		return
+	})
+}
+
+func (l *LoggingDB) BulkLoad(src kvl.PairSource, opts *kvl.BulkOptions) (kvl.BulkStats, error) {
+	stats, err := kvl.BulkLoad(l.Inner, src, opts)
+	log.Printf("%p.BulkLoad(%p) -> (%+v, %v)", l, src, stats, err)
+	return stats, err
+}
+
+func (l *LoggingDB) Capabilities() kvl.Capabilities {
+	return kvl.CapabilitiesOf(l.Inner)
+}
+
+func (l *LoggingDB) Ping() error {
+	err := kvl.Ping(l.Inner)
+	log.Printf("%p.Ping() -> %v", l, err)
+	return err
+}
+
+func (l *LoggingDB) Stats() kvl.Stats {
+	return kvl.StatsOf(l.Inner)
+}
+
+func (l *LoggingDB) Shutdown(ctx context.Context) error {
+	err := kvl.Shutdown(ctx, l.Inner)
+	log.Printf("%p.Shutdown() -> %v", l, err)
+	return err
+}
+
 func (l *LoggingDB) Close() {
 	l.Inner.Close()
 	log.Printf("%p.Close()", l)
@@ -51,6 +88,16 @@ type LoggingCtx struct {
 	Inner kvl.Ctx
 }
 
+func (l *LoggingCtx) TxInfo() kvl.TxInfo {
+	info, _ := kvl.TxInfoOf(l.Inner)
+	return info
+}
+
+func (l *LoggingCtx) TxSize() kvl.TxSize {
+	size, _ := kvl.TxSizeOf(l.Inner)
+	return size
+}
+
 func (l *LoggingCtx) Get(key []byte) (kvl.Pair, error) {
 	p, err := l.Inner.Get(key)
 	log.Printf("%p.Get(%#v) -> (%v, %v)", l, string(key), p, err)
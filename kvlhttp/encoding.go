@@ -0,0 +1,132 @@
+package kvlhttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"unicode/utf8"
+
+	"github.com/encryptio/kvl/tuple"
+)
+
+// A keyEncoding converts keys between bytes and JSON.
+type keyEncoding int
+
+const (
+	// base64Keys encodes keys as base64 JSON strings.
+	base64Keys keyEncoding = iota
+
+	// tupleKeys encodes keys as JSON arrays of tuple elements: strings,
+	// integers, booleans, null, and {"bytes": base64} objects for byte strings
+	// that aren't valid UTF-8.
+	tupleKeys
+)
+
+func parseKeyEncoding(s string) (keyEncoding, error) {
+	switch s {
+	case "", "base64":
+		return base64Keys, nil
+	case "tuple":
+		return tupleKeys, nil
+	default:
+		return 0, fmt.Errorf("unknown key encoding %q", s)
+	}
+}
+
+func (e keyEncoding) decode(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	if e == base64Keys {
+		var s string
+		err := json.Unmarshal(raw, &s)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(s)
+	}
+
+	var elements []json.RawMessage
+	err := json.Unmarshal(raw, &elements)
+	if err != nil {
+		return nil, err
+	}
+
+	t := []byte{}
+	for _, el := range elements {
+		v, err := decodeTupleElement(el)
+		if err != nil {
+			return nil, err
+		}
+		t, err = tuple.Append(t, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func decodeTupleElement(raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case nil, bool, string:
+		return v, nil
+	case json.Number:
+		n, ok := new(big.Int).SetString(string(v), 10)
+		if !ok {
+			return nil, fmt.Errorf("tuple element %v is not an integer", v)
+		}
+		if n.IsInt64() {
+			return n.Int64(), nil
+		}
+		return n, nil
+	case map[string]interface{}:
+		s, ok := v["bytes"].(string)
+		if !ok || len(v) != 1 {
+			return nil, errors.New(`tuple element objects must be {"bytes": base64}`)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unsupported tuple element %s", raw)
+	}
+}
+
+func (e keyEncoding) encode(key []byte) (json.RawMessage, error) {
+	if e == base64Keys {
+		return json.Marshal(base64.StdEncoding.EncodeToString(key))
+	}
+
+	var elements []interface{}
+	for len(key) > 0 {
+		var v interface{}
+		var err error
+		key, err = tuple.UnpackIntoPartial(key, &v)
+		if err != nil {
+			return nil, err
+		}
+
+		if b, ok := v.([]byte); ok {
+			if utf8.Valid(b) {
+				v = string(b)
+			} else {
+				v = map[string]string{"bytes": base64.StdEncoding.EncodeToString(b)}
+			}
+		}
+		elements = append(elements, v)
+	}
+	if elements == nil {
+		elements = []interface{}{}
+	}
+	return json.Marshal(elements)
+}
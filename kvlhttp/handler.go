@@ -0,0 +1,560 @@
+// Package kvlhttp serves a kvl.DB over HTTP with a JSON API.
+//
+// Every endpoint takes a POST with a JSON body and responds with JSON:
+//
+//	/get      {"key": K}                          -> {"key": K, "value": V}
+//	/range    {"low": K, "high": K, "limit": N,
+//	           "descending": B}                   -> {"pairs": [{"key": K, "value": V}, ...]}
+//	/set      {"key": K, "value": V}              -> {}
+//	/delete   {"key": K}                          -> {}
+//	/tx       {"preconditions": [...],
+//	           "ops": [...]}                      -> {}
+//	/watch    {"keys": [K, ...], "ranges": [...],
+//	           "since": T, "timeout_ms": N}       -> {"token": T, "changed": B,
+//	                                                  "keys": [...], "ranges": [...]}
+//
+// Values are base64 strings. Keys are base64 strings too, unless the request
+// has the query parameter keys=tuple, in which case keys in both the request
+// and the response are JSON arrays of tuple elements: strings, integers,
+// booleans, null, and {"bytes": base64} for byte strings that aren't UTF-8.
+// An empty or missing range high key is unbounded.
+//
+// A /tx request runs in a single transaction. Each precondition is
+// {"key": K, "exists": B} or {"key": K, "value": V}; if any fails, nothing is
+// written and the response is a 409 with the index of the failed
+// precondition. Each op is {"op": "set", "key": K, "value": V} or
+// {"op": "delete", "key": K}; deleting a missing key is not an error.
+//
+// A /watch request reads the given keys and ranges and returns their current
+// contents with a token identifying them. If since is given and still matches
+// the current contents, the response is delayed until they change or the
+// timeout passes (with "changed": false), using DB.WatchTx.
+//
+// Errors are reported as {"error": "message"} with a 4xx or 5xx status.
+package kvlhttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/encryptio/kvl"
+)
+
+const (
+	defaultMaxWatchTimeout = time.Minute
+	defaultMaxBodyBytes    = 16 * 1024 * 1024
+)
+
+// Options configures a Handler.
+type Options struct {
+	// ReadOnly rejects /set, /delete and /tx requests.
+	ReadOnly bool
+
+	// MaxWatchTimeout bounds the timeout of /watch requests. Zero means one
+	// minute, which is also the timeout of requests that don't give one.
+	MaxWatchTimeout time.Duration
+
+	// MaxBodyBytes bounds the size of request bodies. Zero means 16MiB.
+	MaxBodyBytes int64
+}
+
+type handler struct {
+	db   kvl.DB
+	opts Options
+	mux  *http.ServeMux
+}
+
+// NewHandler returns an http.Handler serving db.
+func NewHandler(db kvl.DB, opts *Options) http.Handler {
+	h := &handler{db: db, mux: http.NewServeMux()}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.MaxWatchTimeout <= 0 {
+		h.opts.MaxWatchTimeout = defaultMaxWatchTimeout
+	}
+	if h.opts.MaxBodyBytes <= 0 {
+		h.opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	h.mux.HandleFunc("/get", h.serve(h.get, false))
+	h.mux.HandleFunc("/range", h.serve(h.rangeQuery, false))
+	h.mux.HandleFunc("/set", h.serve(h.set, true))
+	h.mux.HandleFunc("/delete", h.serve(h.delete, true))
+	h.mux.HandleFunc("/tx", h.serve(h.tx, true))
+	h.mux.HandleFunc("/watch", h.serve(h.watch, false))
+
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// An httpError is an error with the status code it should be reported with.
+type httpError struct {
+	status  int
+	message string
+	extra   map[string]interface{}
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func badRequest(err error) error {
+	return &httpError{status: http.StatusBadRequest, message: err.Error()}
+}
+
+// request is the state of a single request.
+type request struct {
+	ctx  context.Context
+	keys keyEncoding
+}
+
+func (h *handler) serve(fn func(*request, json.RawMessage) (interface{}, error), writes bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, err := h.handle(fn, writes, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (h *handler) handle(fn func(*request, json.RawMessage) (interface{}, error), writes bool, r *http.Request) (interface{}, error) {
+	if r.Method != "POST" {
+		return nil, &httpError{status: http.StatusMethodNotAllowed, message: "only POST is allowed"}
+	}
+	if writes && h.opts.ReadOnly {
+		return nil, &httpError{status: http.StatusForbidden, message: "database is read-only"}
+	}
+
+	keys, err := parseKeyEncoding(r.URL.Query().Get("keys"))
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	var body json.RawMessage
+	err = json.NewDecoder(http.MaxBytesReader(nil, r.Body, h.opts.MaxBodyBytes)).Decode(&body)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	return fn(&request{ctx: r.Context(), keys: keys}, body)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	resp := map[string]interface{}{}
+
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		status = he.status
+		for k, v := range he.extra {
+			resp[k] = v
+		}
+	case err == kvl.ErrNotFound:
+		status = http.StatusNotFound
+	case err == kvl.ErrWatchUnsupported:
+		status = http.StatusNotImplemented
+	}
+	resp["error"] = err.Error()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+type pairJSON struct {
+	Key   json.RawMessage `json:"key"`
+	Value []byte          `json:"value"`
+}
+
+func (r *request) encodePair(p kvl.Pair) (pairJSON, error) {
+	key, err := r.keys.encode(p.Key)
+	if err != nil {
+		return pairJSON{}, err
+	}
+	return pairJSON{Key: key, Value: p.Value}, nil
+}
+
+func (r *request) encodePairs(pairs []kvl.Pair) ([]pairJSON, error) {
+	out := make([]pairJSON, len(pairs))
+	for i, p := range pairs {
+		var err error
+		out[i], err = r.encodePair(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (r *request) decodeKey(raw json.RawMessage) ([]byte, error) {
+	key, err := r.keys.decode(raw)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return key, nil
+}
+
+func unmarshal(body json.RawMessage, v interface{}) error {
+	err := json.Unmarshal(body, v)
+	if err != nil {
+		return badRequest(err)
+	}
+	return nil
+}
+
+type keyRequest struct {
+	Key json.RawMessage `json:"key"`
+}
+
+func (h *handler) get(r *request, body json.RawMessage) (interface{}, error) {
+	var req keyRequest
+	err := unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.decodeKey(req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var p kvl.Pair
+	err = h.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		p, err = ctx.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.encodePair(p)
+}
+
+type rangeRequest struct {
+	Low        json.RawMessage `json:"low"`
+	High       json.RawMessage `json:"high"`
+	Limit      int             `json:"limit"`
+	Descending bool            `json:"descending"`
+}
+
+func (r *request) decodeRange(req rangeRequest) (kvl.RangeQuery, error) {
+	low, err := r.decodeKey(req.Low)
+	if err != nil {
+		return kvl.RangeQuery{}, err
+	}
+	high, err := r.decodeKey(req.High)
+	if err != nil {
+		return kvl.RangeQuery{}, err
+	}
+	return kvl.RangeQuery{Low: low, High: high, Limit: req.Limit, Descending: req.Descending}, nil
+}
+
+func (h *handler) rangeQuery(r *request, body json.RawMessage) (interface{}, error) {
+	var req rangeRequest
+	err := unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+	query, err := r.decodeRange(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []kvl.Pair
+	err = h.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		pairs, err = ctx.Range(query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := r.encodePairs(pairs)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"pairs": out}, nil
+}
+
+func (h *handler) set(r *request, body json.RawMessage) (interface{}, error) {
+	var req pairJSON
+	err := unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.decodeKey(req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Set(kvl.Pair{key, req.Value})
+	})
+	return struct{}{}, err
+}
+
+func (h *handler) delete(r *request, body json.RawMessage) (interface{}, error) {
+	var req keyRequest
+	err := unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.decodeKey(req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.db.RunTx(func(ctx kvl.Ctx) error {
+		return ctx.Delete(key)
+	})
+	return struct{}{}, err
+}
+
+type txRequest struct {
+	Preconditions []struct {
+		Key    json.RawMessage `json:"key"`
+		Exists *bool           `json:"exists"`
+		Value  []byte          `json:"value"`
+	} `json:"preconditions"`
+	Ops []struct {
+		Op    string          `json:"op"`
+		Key   json.RawMessage `json:"key"`
+		Value []byte          `json:"value"`
+	} `json:"ops"`
+}
+
+func (h *handler) tx(r *request, body json.RawMessage) (interface{}, error) {
+	var req txRequest
+	err := unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	type check struct {
+		key    []byte
+		exists bool
+		value  []byte // checked if non-nil
+	}
+	checks := make([]check, len(req.Preconditions))
+	for i, pre := range req.Preconditions {
+		key, err := r.decodeKey(pre.Key)
+		if err != nil {
+			return nil, err
+		}
+		if (pre.Exists == nil) == (pre.Value == nil) {
+			return nil, badRequest(errors.New(`each precondition needs exactly one of "exists" or "value"`))
+		}
+		c := check{key: key, exists: true, value: pre.Value}
+		if pre.Exists != nil {
+			c.exists = *pre.Exists
+		}
+		checks[i] = c
+	}
+
+	ops := make([]kvl.Pair, len(req.Ops))
+	deletes := make([]bool, len(req.Ops))
+	for i, op := range req.Ops {
+		key, err := r.decodeKey(op.Key)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "set":
+			if op.Value == nil {
+				op.Value = []byte{}
+			}
+			ops[i] = kvl.Pair{key, op.Value}
+		case "delete":
+			ops[i] = kvl.Pair{Key: key}
+			deletes[i] = true
+		default:
+			return nil, badRequest(errors.New(`op must be "set" or "delete"`))
+		}
+	}
+
+	err = h.db.RunTx(func(ctx kvl.Ctx) error {
+		for i, c := range checks {
+			p, err := ctx.Get(c.key)
+			if err != nil && err != kvl.ErrNotFound {
+				return err
+			}
+			found := err == nil
+
+			if found != c.exists || (c.value != nil && !p.Equal(kvl.Pair{c.key, c.value})) {
+				return &httpError{
+					status:  http.StatusConflict,
+					message: "precondition failed",
+					extra:   map[string]interface{}{"index": i},
+				}
+			}
+		}
+
+		for i, p := range ops {
+			var err error
+			if deletes[i] {
+				err = ctx.Delete(p.Key)
+				if err == kvl.ErrNotFound {
+					err = nil
+				}
+			} else {
+				err = ctx.Set(p)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return struct{}{}, err
+}
+
+type watchRequest struct {
+	Keys      []json.RawMessage `json:"keys"`
+	Ranges    []rangeRequest    `json:"ranges"`
+	Since     string            `json:"since"`
+	TimeoutMS int64             `json:"timeout_ms"`
+}
+
+type watchResponse struct {
+	Token   string       `json:"token"`
+	Changed bool         `json:"changed"`
+	Keys    []*pairJSON  `json:"keys"`   // nil for missing keys
+	Ranges  [][]pairJSON `json:"ranges"` // in the order of the request
+}
+
+func (h *handler) watch(r *request, body json.RawMessage) (interface{}, error) {
+	var req watchRequest
+	err := unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, len(req.Keys))
+	for i, raw := range req.Keys {
+		keys[i], err = r.decodeKey(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	queries := make([]kvl.RangeQuery, len(req.Ranges))
+	for i, rr := range req.Ranges {
+		queries[i], err = r.decodeRange(rr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := h.opts.MaxWatchTimeout
+	if req.TimeoutMS > 0 && time.Duration(req.TimeoutMS)*time.Millisecond < timeout {
+		timeout = time.Duration(req.TimeoutMS) * time.Millisecond
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		var resp watchResponse
+		wr, err := h.db.WatchTx(func(ctx kvl.Ctx) error {
+			var err error
+			resp, err = r.readWatched(ctx, keys, queries)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if req.Since == "" || resp.Token != req.Since {
+			wr.Close()
+			resp.Changed = req.Since != ""
+			return resp, nil
+		}
+
+		select {
+		case <-wr.Done():
+			// the Done channel may be closed spuriously or with an error;
+			// either way, check again
+			wr.Close()
+		case <-timer.C:
+			wr.Close()
+			return resp, nil
+		case <-r.ctx.Done():
+			wr.Close()
+			return nil, r.ctx.Err()
+		}
+	}
+}
+
+// readWatched reads the watched keys and ranges, and computes the token of
+// their contents.
+func (r *request) readWatched(ctx kvl.Ctx, keys [][]byte, queries []kvl.RangeQuery) (watchResponse, error) {
+	resp := watchResponse{
+		Keys:   make([]*pairJSON, len(keys)),
+		Ranges: make([][]pairJSON, len(queries)),
+	}
+
+	h := sha256.New()
+	writeField := func(b []byte) {
+		var n [8]byte
+		for i := range n {
+			n[i] = byte(len(b) >> (8 * uint(i)))
+		}
+		h.Write(n[:])
+		h.Write(b)
+	}
+
+	for i, key := range keys {
+		p, err := ctx.Get(key)
+		if err == kvl.ErrNotFound {
+			h.Write([]byte{0})
+			continue
+		}
+		if err != nil {
+			return resp, err
+		}
+
+		h.Write([]byte{1})
+		writeField(p.Value)
+
+		pj, err := r.encodePair(p)
+		if err != nil {
+			return resp, err
+		}
+		resp.Keys[i] = &pj
+	}
+
+	for i, query := range queries {
+		pairs, err := ctx.Range(query)
+		if err != nil {
+			return resp, err
+		}
+
+		writeField([]byte(strconv.Itoa(len(pairs))))
+		for _, p := range pairs {
+			writeField(p.Key)
+			writeField(p.Value)
+		}
+
+		resp.Ranges[i], err = r.encodePairs(pairs)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	resp.Token = hex.EncodeToString(h.Sum(nil))
+	return resp, nil
+}
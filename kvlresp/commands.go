@@ -0,0 +1,213 @@
+package kvlresp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/keys"
+)
+
+const defaultScanCount = 10
+
+// A command runs on the Ctx of a transaction. Problems with the command
+// itself are reported as an errorReply; errors from the Ctx are returned and
+// abort the transaction.
+type command struct {
+	// arity is the exact number of arguments (including the command name),
+	// or the negated minimum.
+	arity    int
+	readonly bool
+	fn       func(ctx kvl.Ctx, args [][]byte) (interface{}, error)
+}
+
+// txCommands are the commands that read or write the DB, and may be queued
+// by MULTI.
+var txCommands = map[string]command{
+	"GET":    {2, true, cmdGet},
+	"SET":    {3, false, cmdSet},
+	"DEL":    {-2, false, cmdDel},
+	"EXISTS": {-2, true, cmdExists},
+	"INCR":   {2, false, cmdIncr},
+	"INCRBY": {3, false, cmdIncrBy},
+	"DECR":   {2, false, cmdDecr},
+	"PING":   {-1, true, cmdPing},
+}
+
+func arityError(name string) errorReply {
+	return errorReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+func checkArity(arity, n int) bool {
+	if arity >= 0 {
+		return n == arity
+	}
+	return n >= -arity
+}
+
+func cmdPing(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	if len(args) > 1 {
+		return args[1], nil
+	}
+	return simpleString("PONG"), nil
+}
+
+func cmdGet(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	p, err := ctx.Get(args[1])
+	if err == kvl.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.Value, nil
+}
+
+func cmdSet(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	err := ctx.Set(kvl.Pair{args[1], args[2]})
+	if err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func cmdDel(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	var deleted int64
+	for _, key := range args[1:] {
+		err := ctx.Delete(key)
+		if err == kvl.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func cmdExists(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	var found int64
+	for _, key := range args[1:] {
+		_, err := ctx.Get(key)
+		if err == kvl.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found++
+	}
+	return found, nil
+}
+
+func cmdIncr(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	return incrBy(ctx, args[1], 1)
+}
+
+func cmdDecr(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	return incrBy(ctx, args[1], -1)
+}
+
+func cmdIncrBy(ctx kvl.Ctx, args [][]byte) (interface{}, error) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errorReply("ERR value is not an integer or out of range"), nil
+	}
+	return incrBy(ctx, args[1], delta)
+}
+
+// incrBy adds delta to the decimal integer stored at key, treating a missing
+// key as zero.
+func incrBy(ctx kvl.Ctx, key []byte, delta int64) (interface{}, error) {
+	var n int64
+	p, err := ctx.Get(key)
+	if err == nil {
+		n, err = strconv.ParseInt(string(p.Value), 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range"), nil
+		}
+	} else if err != kvl.ErrNotFound {
+		return nil, err
+	}
+
+	if (delta > 0 && n > n+delta) || (delta < 0 && n < n+delta) {
+		return errorReply("ERR increment or decrement would overflow"), nil
+	}
+	n += delta
+
+	err = ctx.Set(kvl.Pair{key, []byte(strconv.FormatInt(n, 10))})
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// scanArgs are the parsed arguments of a SCAN command.
+type scanArgs struct {
+	cursor uint64
+	prefix []byte
+	count  int
+}
+
+func parseScan(args [][]byte) (scanArgs, interface{}) {
+	var sa scanArgs
+	var err error
+
+	sa.cursor, err = strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return sa, errorReply("ERR invalid cursor")
+	}
+	sa.count = defaultScanCount
+
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return sa, errorReply("ERR syntax error")
+		}
+		value := args[i+1]
+
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			if len(value) == 0 || value[len(value)-1] != '*' ||
+				bytes.ContainsAny(value[:len(value)-1], `*?[\`) {
+				return sa, errorReply("ERR only MATCH patterns of the form prefix* are supported")
+			}
+			sa.prefix = value[:len(value)-1]
+		case "COUNT":
+			sa.count, err = strconv.Atoi(string(value))
+			if err != nil || sa.count < 1 {
+				return sa, errorReply("ERR value is not an integer or out of range")
+			}
+		default:
+			return sa, errorReply("ERR syntax error")
+		}
+	}
+	return sa, nil
+}
+
+// scan returns up to count keys with the prefix starting at from, and the key
+// to continue from, which is nil at the end.
+func scan(ctx kvl.Ctx, prefix, from []byte, count int) ([][]byte, []byte, error) {
+	low, high := keys.PrefixRange(prefix)
+	if bytes.Compare(from, low) > 0 {
+		low = from
+	}
+
+	pairs, err := ctx.Range(kvl.RangeQuery{Low: low, High: high, Limit: count})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make([][]byte, len(pairs))
+	for i, p := range pairs {
+		found[i] = p.Key
+	}
+
+	var next []byte
+	if len(pairs) == count {
+		next = keys.Successor(pairs[len(pairs)-1].Key)
+	}
+	return found, next, nil
+}
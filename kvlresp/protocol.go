@@ -0,0 +1,125 @@
+package kvlresp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLength  = 512 * 1024 * 1024
+	maxArrayLength = 1024 * 1024
+	maxLineLength  = 64 * 1024
+)
+
+var errProtocol = errors.New("protocol error")
+
+// Reply types, encoded by writeReply. A []byte is a bulk string, a nil
+// interface is a null bulk string, and an int64 is an integer.
+type (
+	simpleString string
+	errorReply   string
+	arrayReply   []interface{}
+)
+
+var okReply = simpleString("OK")
+
+// readCommand reads a command, either as a RESP array of bulk strings or as
+// an inline command (space separated words on a line), as sent by telnet.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		var args [][]byte
+		for _, word := range strings.Fields(line) {
+			args = append(args, []byte(word))
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArrayLength {
+		return nil, errProtocol
+	}
+
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLength {
+			return nil, errProtocol
+		}
+
+		buf := make([]byte, size+2)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, buf[:size])
+	}
+	return args, nil
+}
+
+// readLine reads a line of at most maxLineLength bytes, including its end,
+// returning errProtocol for longer lines.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return "", errProtocol
+		}
+		if err == bufio.ErrBufferFull {
+			if len(line) == maxLineLength {
+				// no room is left for the end of the line
+				return "", errProtocol
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case simpleString:
+		fmt.Fprintf(w, "+%s\r\n", string(reply))
+	case errorReply:
+		fmt.Fprintf(w, "-%s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(string(reply)))
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", reply)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n", len(reply))
+		w.Write(reply)
+		w.WriteString("\r\n")
+	case arrayReply:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, r := range reply {
+			writeReply(w, r)
+		}
+	default:
+		panic(fmt.Sprintf("unknown reply type %T", reply))
+	}
+}
@@ -0,0 +1,330 @@
+// Package kvlresp serves a kvl.DB over a subset of the Redis protocol (RESP),
+// so that redis-cli and Redis client libraries can read and write kvl data.
+//
+// The supported commands are GET, SET (without options), DEL, EXISTS, INCR,
+// INCRBY, DECR, SCAN (with MATCH patterns of the form prefix* only, and
+// COUNT), MULTI, EXEC, DISCARD, PING, ECHO, SELECT 0, COMMAND (returning no
+// command information) and QUIT.
+//
+// Every command runs in its own transaction. Commands queued with MULTI run
+// together in a single transaction when EXEC is called. As in Redis, a
+// command that fails (such as INCR of a non-integer) doesn't stop the others,
+// but an error from the DB rolls back the whole transaction and is returned by
+// EXEC.
+//
+// SCAN cursors are only valid on the connection that received them.
+package kvlresp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/encryptio/kvl"
+)
+
+// maxCursors bounds the number of SCAN cursors remembered per connection.
+const maxCursors = 1024
+
+// A Server serves a kvl.DB to Redis clients.
+type Server struct {
+	db kvl.DB
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[io.Closer]struct{}
+	closed    bool
+}
+
+// NewServer returns a Server serving db. The db is not closed by the Server.
+func NewServer(db kvl.DB) *Server {
+	return &Server{
+		db:        db,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[io.Closer]struct{}),
+	}
+}
+
+// Serve accepts connections on l and serves each one in its own goroutine. It
+// returns when l fails to accept, such as after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// Close stops all listeners passed to Serve and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return nil
+}
+
+// ServeConn serves a single connection until the client hangs up or sends
+// QUIT, and then closes it.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	c := &session{
+		db:      s.db,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		cursors: make(map[uint64][]byte),
+	}
+	c.serve()
+}
+
+// session is the state of a single client connection.
+type session struct {
+	db kvl.DB
+	r  *bufio.Reader
+	w  *bufio.Writer
+
+	inMulti bool
+	queued  [][][]byte
+	failed  bool // a command could not be queued; EXEC fails
+
+	cursors    map[uint64][]byte
+	nextCursor uint64
+}
+
+func (c *session) serve() {
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if err == errProtocol {
+				writeReply(c.w, errorReply("ERR Protocol error"))
+				c.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToUpper(string(args[0]))
+		if name == "QUIT" {
+			writeReply(c.w, okReply)
+			c.w.Flush()
+			return
+		}
+
+		writeReply(c.w, c.handle(name, args))
+
+		// flush unless more pipelined commands are already waiting
+		if c.r.Buffered() == 0 {
+			err = c.w.Flush()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *session) handle(name string, args [][]byte) interface{} {
+	switch name {
+	case "MULTI":
+		if c.inMulti {
+			return errorReply("ERR MULTI calls can not be nested")
+		}
+		c.inMulti = true
+		c.queued = nil
+		c.failed = false
+		return okReply
+
+	case "DISCARD":
+		if !c.inMulti {
+			return errorReply("ERR DISCARD without MULTI")
+		}
+		c.inMulti = false
+		c.queued = nil
+		return okReply
+
+	case "EXEC":
+		if !c.inMulti {
+			return errorReply("ERR EXEC without MULTI")
+		}
+		queued, failed := c.queued, c.failed
+		c.inMulti = false
+		c.queued = nil
+		if failed {
+			return errorReply("EXECABORT Transaction discarded because of previous errors.")
+		}
+		return c.exec(queued)
+	}
+
+	cmd, ok := txCommands[name]
+	if !ok {
+		if c.inMulti {
+			c.failed = true
+			return errorReply("ERR command not allowed in MULTI")
+		}
+		return c.handleOther(name, args)
+	}
+	if !checkArity(cmd.arity, len(args)) {
+		c.failed = c.failed || c.inMulti
+		return arityError(name)
+	}
+
+	if c.inMulti {
+		c.queued = append(c.queued, args)
+		return simpleString("QUEUED")
+	}
+
+	var reply interface{}
+	run := c.db.RunTx
+	if cmd.readonly {
+		run = c.db.RunReadTx
+	}
+	err := run(func(ctx kvl.Ctx) error {
+		var err error
+		reply, err = cmd.fn(ctx, args)
+		return err
+	})
+	if err != nil {
+		return errorReply("ERR " + err.Error())
+	}
+	return reply
+}
+
+// exec runs queued commands in one transaction.
+func (c *session) exec(queued [][][]byte) interface{} {
+	var replies arrayReply
+	err := c.db.RunTx(func(ctx kvl.Ctx) error {
+		replies = make(arrayReply, 0, len(queued))
+		for _, args := range queued {
+			cmd := txCommands[strings.ToUpper(string(args[0]))]
+			reply, err := cmd.fn(ctx, args)
+			if err != nil {
+				return err
+			}
+			replies = append(replies, reply)
+		}
+		return nil
+	})
+	if err != nil {
+		return errorReply("ERR " + err.Error())
+	}
+	return replies
+}
+
+// handleOther handles the commands that don't touch the DB, and SCAN.
+func (c *session) handleOther(name string, args [][]byte) interface{} {
+	switch name {
+	case "ECHO":
+		if len(args) != 2 {
+			return arityError(name)
+		}
+		return args[1]
+
+	case "SELECT":
+		if len(args) != 2 {
+			return arityError(name)
+		}
+		if string(args[1]) != "0" {
+			return errorReply("ERR DB index is out of range")
+		}
+		return okReply
+
+	case "COMMAND":
+		return arrayReply{}
+
+	case "SCAN":
+		if len(args) < 2 {
+			return arityError(name)
+		}
+		return c.scan(args)
+
+	default:
+		return errorReply("ERR unknown command '" + strings.ToLower(name) + "'")
+	}
+}
+
+func (c *session) scan(args [][]byte) interface{} {
+	sa, errReply := parseScan(args)
+	if errReply != nil {
+		return errReply
+	}
+
+	var from []byte
+	if sa.cursor != 0 {
+		var ok bool
+		from, ok = c.cursors[sa.cursor]
+		if !ok {
+			return errorReply("ERR invalid cursor")
+		}
+		delete(c.cursors, sa.cursor)
+	}
+
+	var next []byte
+	var keys [][]byte
+	err := c.db.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		keys, next, err = scan(ctx, sa.prefix, from, sa.count)
+		return err
+	})
+	if err != nil {
+		return errorReply("ERR " + err.Error())
+	}
+
+	cursor := uint64(0)
+	if next != nil {
+		if len(c.cursors) >= maxCursors {
+			// forget abandoned scans
+			c.cursors = make(map[uint64][]byte)
+		}
+		c.nextCursor++
+		cursor = c.nextCursor
+		c.cursors[cursor] = next
+	}
+
+	keyReplies := make(arrayReply, len(keys))
+	for i, k := range keys {
+		keyReplies[i] = k
+	}
+	return arrayReply{[]byte(strconv.FormatUint(cursor, 10)), keyReplies}
+}
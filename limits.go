@@ -0,0 +1,221 @@
+package kvl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Limits bounds the writes made by a single transaction. Zero fields are
+// unlimited.
+type Limits struct {
+	// MaxWrites limits the number of successful Set and Delete calls.
+	MaxWrites int
+
+	// MaxWriteBytes limits the total size of the keys and values passed to
+	// successful Set and Delete calls.
+	MaxWriteBytes int64
+
+	// MaxKeySize and MaxValueSize limit the size of each key and value
+	// written.
+	MaxKeySize   int
+	MaxValueSize int
+}
+
+// TxSize is the size of the writes a transaction has made so far, as counted
+// against Limits.
+type TxSize struct {
+	Writes int
+	Bytes  int64
+}
+
+// ErrTransactionTooLarge matches every *TransactionTooLargeError with
+// errors.Is.
+var ErrTransactionTooLarge = errors.New("transaction too large")
+
+// A TransactionTooLargeError is returned by a write that would exceed one of
+// the Limits of its transaction. The write is not made.
+type TransactionTooLargeError struct {
+	// Limit is the name of the Limits field that would be exceeded.
+	Limit string
+
+	// Max is the value of the limit, and Size the size the write would have
+	// reached.
+	Max, Size int64
+}
+
+func (e *TransactionTooLargeError) Error() string {
+	return fmt.Sprintf("transaction too large: %v is %v, would be %v", e.Limit, e.Max, e.Size)
+}
+
+func (e *TransactionTooLargeError) Is(target error) bool {
+	return target == ErrTransactionTooLarge
+}
+
+// Add returns the size of a transaction of the given size after writing key
+// and value (nil for deletes), or a *TransactionTooLargeError if the write
+// would exceed the limits. Backends enforcing limits themselves call it before
+// every write, and keep the new size only if the write succeeds.
+func (l Limits) Add(size TxSize, key, value []byte) (TxSize, error) {
+	if l.MaxKeySize > 0 && len(key) > l.MaxKeySize {
+		return size, &TransactionTooLargeError{"MaxKeySize", int64(l.MaxKeySize), int64(len(key))}
+	}
+	if l.MaxValueSize > 0 && len(value) > l.MaxValueSize {
+		return size, &TransactionTooLargeError{"MaxValueSize", int64(l.MaxValueSize), int64(len(value))}
+	}
+
+	next := TxSize{
+		Writes: size.Writes + 1,
+		Bytes:  size.Bytes + int64(len(key)+len(value)),
+	}
+	if l.MaxWrites > 0 && next.Writes > l.MaxWrites {
+		return size, &TransactionTooLargeError{"MaxWrites", int64(l.MaxWrites), int64(next.Writes)}
+	}
+	if l.MaxWriteBytes > 0 && next.Bytes > l.MaxWriteBytes {
+		return size, &TransactionTooLargeError{"MaxWriteBytes", l.MaxWriteBytes, next.Bytes}
+	}
+	return next, nil
+}
+
+// A TxSizeCtx is a Ctx that counts the size of its transaction's writes. Use
+// TxSizeOf to query any Ctx.
+type TxSizeCtx interface {
+	Ctx
+
+	TxSize() TxSize
+}
+
+// TxSizeOf returns ctx.TxSize() if ctx is a TxSizeCtx. ok is false otherwise.
+//
+// Ctxs that wrap another, such as SubCtx, report the size of the wrapped Ctx,
+// which is zero if it does not count its writes.
+func TxSizeOf(ctx Ctx) (size TxSize, ok bool) {
+	if sctx, ok := ctx.(TxSizeCtx); ok {
+		return sctx.TxSize(), true
+	}
+	return TxSize{}, false
+}
+
+type limitDB struct {
+	db     DB
+	limits Limits
+}
+
+// LimitDB returns a DB that enforces limits on the transactions run on db,
+// whose Ctxs are TxSizeCtxs. Closing it closes db.
+//
+// Backends that accept Limits in their options enforce them without a
+// wrapper.
+func LimitDB(db DB, limits Limits) DB {
+	return limitDB{db, limits}
+}
+
+func (l limitDB) RunTx(tx Tx) error {
+	return l.db.RunTx(func(ctx Ctx) error {
+		return tx(&limitCtx{ctx: ctx, limits: l.limits})
+	})
+}
+
+func (l limitDB) RunReadTx(tx Tx) error {
+	return l.db.RunReadTx(func(ctx Ctx) error {
+		return tx(&limitCtx{ctx: ctx, limits: l.limits})
+	})
+}
+
+func (l limitDB) WatchTx(tx Tx) (WatchResult, error) {
+	return l.db.WatchTx(func(ctx Ctx) error {
+		return tx(&limitCtx{ctx: ctx, limits: l.limits})
+	})
+}
+
+func (l limitDB) RunSnapshotTx(tx Tx) error {
+	return RunSnapshotTx(l.db, func(ctx Ctx) error {
+		return tx(&limitCtx{ctx: ctx, limits: l.limits})
+	})
+}
+
+// BulkLoad checks each pair against the limits, but not the batches.
+func (l limitDB) BulkLoad(src PairSource, opts *BulkOptions) (BulkStats, error) {
+	return BulkLoad(l.db, limitSource{src, l.limits}, opts)
+}
+
+type limitSource struct {
+	src    PairSource
+	limits Limits
+}
+
+func (s limitSource) Next() (Pair, error) {
+	p, err := s.src.Next()
+	if err != nil {
+		return p, err
+	}
+	_, err = s.limits.Add(TxSize{}, p.Key, p.Value)
+	return p, err
+}
+
+func (l limitDB) Capabilities() Capabilities {
+	return CapabilitiesOf(l.db)
+}
+
+func (l limitDB) Ping() error {
+	return Ping(l.db)
+}
+
+func (l limitDB) Stats() Stats {
+	return StatsOf(l.db)
+}
+
+func (l limitDB) Shutdown(ctx context.Context) error {
+	return Shutdown(ctx, l.db)
+}
+
+func (l limitDB) Close() {
+	l.db.Close()
+}
+
+type limitCtx struct {
+	ctx    Ctx
+	limits Limits
+	size   TxSize
+}
+
+func (c *limitCtx) Get(key []byte) (Pair, error) {
+	return c.ctx.Get(key)
+}
+
+func (c *limitCtx) Range(query RangeQuery) ([]Pair, error) {
+	return c.ctx.Range(query)
+}
+
+func (c *limitCtx) Set(p Pair) error {
+	size, err := c.limits.Add(c.size, p.Key, p.Value)
+	if err != nil {
+		return err
+	}
+	err = c.ctx.Set(p)
+	if err == nil {
+		c.size = size
+	}
+	return err
+}
+
+func (c *limitCtx) Delete(key []byte) error {
+	size, err := c.limits.Add(c.size, key, nil)
+	if err != nil {
+		return err
+	}
+	err = c.ctx.Delete(key)
+	if err == nil {
+		c.size = size
+	}
+	return err
+}
+
+func (c *limitCtx) TxSize() TxSize {
+	return c.size
+}
+
+func (c *limitCtx) TxInfo() TxInfo {
+	info, _ := TxInfoOf(c.ctx)
+	return info
+}
@@ -0,0 +1,238 @@
+// Package migrate copies the contents of one DB into another, possibly of a
+// different backend, and verifies the copy.
+package migrate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/keys"
+)
+
+const defaultChunkSize = 1000
+
+var ErrChecksumMismatch = errors.New("migrate: source and destination checksums differ")
+
+// Options configures Copy and Checksum.
+type Options struct {
+	// ChunkSize is the number of source pairs handled by each transaction.
+	// Zero means 1000.
+	ChunkSize int
+
+	// Start is the key to start at. Pass the Resume field of the Stats from an
+	// interrupted Copy to continue it.
+	Start []byte
+}
+
+func (o *Options) withDefaults() Options {
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	return opts
+}
+
+type Stats struct {
+	Checked      uint64 // source pairs read
+	Copied       uint64 // pairs created or changed in the destination
+	Deleted      uint64 // destination pairs not in the source
+	Transactions uint64
+
+	// Resume is the key the next chunk starts at, or nil once the copy has
+	// reached the end of the source.
+	Resume []byte
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf(
+		"checked %v pairs, copied %v, deleted %v in %v transactions",
+		s.Checked, s.Copied, s.Deleted, s.Transactions)
+}
+
+// Copy makes the destination contain the same pairs as the source, chunk by
+// chunk in key order. Each chunk is read from src in one transaction, and the
+// destination keys in the same range are made to match it in one
+// transaction on dst: missing and different pairs are written, and extra
+// pairs are deleted.
+//
+// Since only differences are written, running Copy again after a first pass
+// is a cheap catch-up pass that copies just the writes made to the source in
+// the meantime. Writes made to the source during a pass may or may not be
+// copied by it; stop writing to the source before the final pass.
+//
+// The progress channel passed, if any, will be sent partial Stats after every
+// chunk. If Copy fails, the returned Stats' Resume field can be passed as
+// Options.Start to continue where it stopped.
+func Copy(dst, src kvl.DB, o *Options, progress chan<- Stats) (Stats, error) {
+	opts := o.withDefaults()
+
+	stats := Stats{Resume: opts.Start}
+	for {
+		low := stats.Resume
+
+		var pairs []kvl.Pair
+		err := src.RunReadTx(func(ctx kvl.Ctx) error {
+			var err error
+			pairs, err = ctx.Range(kvl.RangeQuery{Low: low, Limit: opts.ChunkSize})
+			return err
+		})
+		if err != nil {
+			return stats, err
+		}
+
+		// the chunk covers [low, high); the last chunk extends to the end
+		var high []byte
+		if len(pairs) == opts.ChunkSize {
+			high = keys.Successor(pairs[len(pairs)-1].Key)
+		}
+
+		var copied, deleted uint64
+		err = dst.RunTx(func(ctx kvl.Ctx) error {
+			copied, deleted = 0, 0
+
+			existing, err := ctx.Range(kvl.RangeQuery{Low: low, High: high})
+			if err != nil {
+				return err
+			}
+
+			i := 0
+			for _, p := range pairs {
+				for i < len(existing) && bytes.Compare(existing[i].Key, p.Key) < 0 {
+					err = ctx.Delete(existing[i].Key)
+					if err != nil {
+						return err
+					}
+					deleted++
+					i++
+				}
+
+				if i < len(existing) && bytes.Equal(existing[i].Key, p.Key) {
+					i++
+					if bytes.Equal(existing[i-1].Value, p.Value) {
+						continue
+					}
+				}
+
+				err = ctx.Set(p)
+				if err != nil {
+					return err
+				}
+				copied++
+			}
+
+			for ; i < len(existing); i++ {
+				err = ctx.Delete(existing[i].Key)
+				if err != nil {
+					return err
+				}
+				deleted++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Checked += uint64(len(pairs))
+		stats.Copied += copied
+		stats.Deleted += deleted
+		stats.Transactions += 2
+		stats.Resume = high
+
+		if progress != nil {
+			progress <- stats
+		}
+
+		if high == nil {
+			return stats, nil
+		}
+	}
+}
+
+// A Sum is a checksum of the contents of a DB.
+type Sum struct {
+	Pairs uint64
+	Hash  [sha256.Size]byte
+}
+
+func (s Sum) String() string {
+	return fmt.Sprintf("%v pairs, sha256 %x", s.Pairs, s.Hash)
+}
+
+// Checksum computes a SHA-256 hash of all pairs in the DB from Options.Start
+// on, reading them in chunks of separate transactions. The result depends only
+// on the pairs, not on the backend.
+func Checksum(db kvl.DB, o *Options) (Sum, error) {
+	opts := o.withDefaults()
+
+	var sum Sum
+	h := sha256.New()
+	low := opts.Start
+	for {
+		var pairs []kvl.Pair
+		err := db.RunReadTx(func(ctx kvl.Ctx) error {
+			var err error
+			pairs, err = ctx.Range(kvl.RangeQuery{Low: low, Limit: opts.ChunkSize})
+			return err
+		})
+		if err != nil {
+			return sum, err
+		}
+
+		for _, p := range pairs {
+			writeField(h, p.Key)
+			writeField(h, p.Value)
+		}
+		sum.Pairs += uint64(len(pairs))
+
+		if len(pairs) < opts.ChunkSize {
+			break
+		}
+		low = keys.Successor(pairs[len(pairs)-1].Key)
+	}
+
+	h.Sum(sum.Hash[:0])
+	return sum, nil
+}
+
+func writeField(h hash.Hash, b []byte) {
+	var lenBuf [binary.MaxVarintLen64]byte
+	h.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(b)))])
+	h.Write(b)
+}
+
+// Verify checksums both DBs, and returns ErrChecksumMismatch if they differ.
+func Verify(dst, src kvl.DB, o *Options) error {
+	type result struct {
+		sum Sum
+		err error
+	}
+	srcResult := make(chan result, 1)
+	go func() {
+		sum, err := Checksum(src, o)
+		srcResult <- result{sum, err}
+	}()
+
+	dstSum, err := Checksum(dst, o)
+	r := <-srcResult
+	if err != nil {
+		return err
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if dstSum != r.sum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+// Package mirror implements a DB that writes to two DBs, for migrating between
+// backends without downtime.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/encryptio/kvl"
+)
+
+// A FailurePolicy decides what a mirrored DB does when a transaction fails on
+// the shadow DB after it committed on the primary.
+type FailurePolicy int
+
+const (
+	// ReportShadowErrors passes shadow errors to Options.OnShadowError and
+	// otherwise ignores them.
+	ReportShadowErrors FailurePolicy = iota
+
+	// ReturnShadowErrors also returns shadow errors from RunTx and RunReadTx,
+	// wrapped in a *ShadowError. The transaction has still been committed on
+	// the primary.
+	ReturnShadowErrors
+
+	// DisableShadow reports the first shadow error and stops using the shadow
+	// DB from then on, since it has missed a write.
+	DisableShadow
+)
+
+// A ShadowError is returned when a transaction committed on the primary DB but
+// failed on the shadow DB, and the FailurePolicy is ReturnShadowErrors.
+type ShadowError struct {
+	Err error
+}
+
+func (e *ShadowError) Error() string {
+	return fmt.Sprintf("mirror: shadow transaction failed: %v", e.Err)
+}
+
+// A Divergence is an operation that had different results on the primary and
+// shadow DBs. Op is "Get", "Range" or "Delete"; Key is set for Get and Delete,
+// Query for Range.
+type Divergence struct {
+	Op    string
+	Key   []byte
+	Query kvl.RangeQuery
+
+	Primary, Shadow       []kvl.Pair
+	PrimaryErr, ShadowErr error
+}
+
+func (d Divergence) String() string {
+	var what string
+	if d.Op == "Range" {
+		what = fmt.Sprintf("Range(%+v)", d.Query)
+	} else {
+		what = fmt.Sprintf("%v(%q)", d.Op, d.Key)
+	}
+	return fmt.Sprintf("%v: primary returned (%v, %v), shadow returned (%v, %v)",
+		what, d.Primary, d.PrimaryErr, d.Shadow, d.ShadowErr)
+}
+
+// Options configures a mirrored DB.
+type Options struct {
+	// Compare makes the shadow DB also run the reads of every transaction and
+	// compare their results with the primary's. Read-only transactions are
+	// only run on the shadow when Compare is set.
+	Compare bool
+
+	// OnDivergence, if non-nil, is called with every difference found by
+	// Compare and every Delete that found a key on one DB but not the other.
+	OnDivergence func(Divergence)
+
+	// Policy decides what happens when a transaction fails on the shadow.
+	Policy FailurePolicy
+
+	// OnShadowError, if non-nil, is called with every shadow error.
+	OnShadowError func(error)
+}
+
+type db struct {
+	primary, shadow kvl.DB
+	opts            Options
+
+	// writeMu serializes read/write transactions, so that they are applied to
+	// the shadow in the same order as on the primary.
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	disabled bool
+}
+
+// New returns a DB that runs every transaction on primary, and then replays
+// its operations on shadow in a transaction of its own.
+//
+// Results always come from the primary. Read/write transactions are
+// serialized, and WatchTx only watches the primary. Closing the returned DB
+// closes both DBs.
+func New(primary, shadow kvl.DB, opts Options) kvl.DB {
+	return &db{
+		primary: primary,
+		shadow:  shadow,
+		opts:    opts,
+	}
+}
+
+func (d *db) RunTx(tx kvl.Tx) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+
+	var ops []op
+	err := d.primary.RunTx(func(ctx kvl.Ctx) error {
+		rec := &recordingCtx{inner: ctx}
+		err := tx(rec)
+		ops = rec.ops
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.replay(d.shadow.RunTx, ops)
+}
+
+func (d *db) RunReadTx(tx kvl.Tx) error {
+	if !d.opts.Compare {
+		return d.primary.RunReadTx(tx)
+	}
+
+	var ops []op
+	err := d.primary.RunReadTx(func(ctx kvl.Ctx) error {
+		rec := &recordingCtx{inner: ctx}
+		err := tx(rec)
+		ops = rec.ops
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.replay(d.shadow.RunReadTx, ops)
+}
+
+func (d *db) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	return d.primary.WatchTx(tx)
+}
+
+// Capabilities reports the capabilities of the primary, except Snapshot,
+// which a mirror does not support.
+func (d *db) Capabilities() kvl.Capabilities {
+	caps := kvl.CapabilitiesOf(d.primary)
+	caps.Snapshot = false
+	return caps
+}
+
+// Ping checks the primary.
+func (d *db) Ping() error {
+	return kvl.Ping(d.primary)
+}
+
+// Stats reports the Stats of the primary.
+func (d *db) Stats() kvl.Stats {
+	return kvl.StatsOf(d.primary)
+}
+
+// Shutdown shuts down the primary and then the shadow, returning the first
+// error.
+func (d *db) Shutdown(ctx context.Context) error {
+	err := kvl.Shutdown(ctx, d.primary)
+	err2 := kvl.Shutdown(ctx, d.shadow)
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (d *db) Close() {
+	d.primary.Close()
+	d.shadow.Close()
+}
+
+// replay runs the recorded operations on the shadow DB with run, and applies
+// the failure policy to the result.
+func (d *db) replay(run func(kvl.Tx) error, ops []op) error {
+	d.mu.Lock()
+	disabled := d.disabled
+	d.mu.Unlock()
+	if disabled {
+		return nil
+	}
+
+	var divergences []Divergence
+	err := run(func(ctx kvl.Ctx) error {
+		divergences = divergences[:0]
+		for _, o := range ops {
+			div, err := o.replay(ctx, d.opts.Compare)
+			if err != nil {
+				return err
+			}
+			if div != nil {
+				divergences = append(divergences, *div)
+			}
+		}
+		return nil
+	})
+
+	if err == nil {
+		if d.opts.OnDivergence != nil {
+			for _, div := range divergences {
+				d.opts.OnDivergence(div)
+			}
+		}
+		return nil
+	}
+
+	if d.opts.OnShadowError != nil {
+		d.opts.OnShadowError(err)
+	}
+
+	switch d.opts.Policy {
+	case ReturnShadowErrors:
+		return &ShadowError{err}
+	case DisableShadow:
+		d.mu.Lock()
+		d.disabled = true
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+type opKind int
+
+const (
+	opGet opKind = iota
+	opRange
+	opSet
+	opDelete
+)
+
+// op is a recorded Ctx operation and its result on the primary.
+type op struct {
+	kind  opKind
+	key   []byte
+	query kvl.RangeQuery
+	pair  kvl.Pair   // the argument of Set
+	pairs []kvl.Pair // the result of Get and Range
+	err   error
+}
+
+// replay performs the operation on ctx, returning a Divergence if its result
+// differs. Errors other than kvl.ErrNotFound abort the replay.
+func (o op) replay(ctx kvl.Ctx, compare bool) (*Divergence, error) {
+	switch o.kind {
+	case opSet:
+		return nil, ctx.Set(o.pair)
+
+	case opDelete:
+		err := ctx.Delete(o.key)
+		if err != nil && err != kvl.ErrNotFound {
+			return nil, err
+		}
+		if err != o.err {
+			return &Divergence{Op: "Delete", Key: o.key, PrimaryErr: o.err, ShadowErr: err}, nil
+		}
+		return nil, nil
+
+	case opGet:
+		if !compare {
+			return nil, nil
+		}
+		p, err := ctx.Get(o.key)
+		if err != nil && err != kvl.ErrNotFound {
+			return nil, err
+		}
+		var pairs []kvl.Pair
+		if err == nil {
+			pairs = []kvl.Pair{p}
+		}
+		if err != o.err || !pairsEqual(pairs, o.pairs) {
+			return &Divergence{Op: "Get", Key: o.key,
+				Primary: o.pairs, PrimaryErr: o.err,
+				Shadow: pairs, ShadowErr: err}, nil
+		}
+		return nil, nil
+
+	case opRange:
+		if !compare {
+			return nil, nil
+		}
+		pairs, err := ctx.Range(o.query)
+		if err != nil {
+			return nil, err
+		}
+		if !pairsEqual(pairs, o.pairs) {
+			return &Divergence{Op: "Range", Query: o.query,
+				Primary: o.pairs, PrimaryErr: o.err,
+				Shadow: pairs}, nil
+		}
+		return nil, nil
+	}
+
+	panic("unknown op kind")
+}
+
+func pairsEqual(a, b []kvl.Pair) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordingCtx records the operations made through it. Failed operations other
+// than lookups of missing keys are not recorded, since they changed nothing.
+// Keys and values are copied, since they are replayed after the primary's
+// transaction has ended and may point into its memory.
+type recordingCtx struct {
+	inner kvl.Ctx
+	ops   []op
+}
+
+func (c *recordingCtx) TxInfo() kvl.TxInfo {
+	info, _ := kvl.TxInfoOf(c.inner)
+	return info
+}
+
+func (c *recordingCtx) TxSize() kvl.TxSize {
+	size, _ := kvl.TxSizeOf(c.inner)
+	return size
+}
+
+func (c *recordingCtx) Get(key []byte) (kvl.Pair, error) {
+	p, err := c.inner.Get(key)
+	if err == nil {
+		c.ops = append(c.ops, op{
+			kind:  opGet,
+			key:   copyBytes(key),
+			pairs: []kvl.Pair{{copyBytes(p.Key), copyBytes(p.Value)}},
+		})
+	} else if err == kvl.ErrNotFound {
+		c.ops = append(c.ops, op{kind: opGet, key: copyBytes(key), err: err})
+	}
+	return p, err
+}
+
+func (c *recordingCtx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
+	pairs, err := c.inner.Range(query)
+	if err == nil {
+		query.Low = copyBytes(query.Low)
+		query.High = copyBytes(query.High)
+		saved := make([]kvl.Pair, len(pairs))
+		for i, p := range pairs {
+			saved[i] = kvl.Pair{copyBytes(p.Key), copyBytes(p.Value)}
+		}
+		c.ops = append(c.ops, op{kind: opRange, query: query, pairs: saved})
+	}
+	return pairs, err
+}
+
+func (c *recordingCtx) Set(p kvl.Pair) error {
+	err := c.inner.Set(p)
+	if err == nil {
+		c.ops = append(c.ops, op{kind: opSet, pair: kvl.Pair{copyBytes(p.Key), copyBytes(p.Value)}})
+	}
+	return err
+}
+
+func (c *recordingCtx) Delete(key []byte) error {
+	err := c.inner.Delete(key)
+	if err == nil || err == kvl.ErrNotFound {
+		c.ops = append(c.ops, op{kind: opDelete, key: copyBytes(key), err: err})
+	}
+	return err
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
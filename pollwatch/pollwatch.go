@@ -0,0 +1,320 @@
+// Package pollwatch implements WatchTx for DBs without native watch support
+// by periodically re-reading the keys and ranges a watched transaction read.
+package pollwatch
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/encryptio/kvl"
+)
+
+const defaultInterval = time.Second
+
+// Options configures the polling of a DB returned by New.
+type Options struct {
+	// Interval is the time between re-reads of a watched transaction's reads.
+	// Zero means one second.
+	Interval time.Duration
+
+	// Jitter is the maximum random duration added to each Interval, to spread
+	// the polling of many watches over time.
+	Jitter time.Duration
+}
+
+type db struct {
+	inner kvl.DB
+	opts  Options
+
+	mu      sync.Mutex
+	pollers map[*poller]struct{}
+}
+
+// New returns a DB that runs transactions on inner, and implements WatchTx by
+// polling if inner.WatchTx returns kvl.ErrWatchUnsupported. Watches on DBs
+// with native support are passed through.
+//
+// A polled watch records the results of every Get and Range made by the
+// watched Tx, and re-runs them in a read transaction every Interval (plus up
+// to Jitter), closing Done when any result differs. Changes that are reverted
+// between two polls are missed.
+//
+// Closing the returned DB stops all polling and closes inner.
+func New(inner kvl.DB, opts Options) kvl.DB {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	return &db{
+		inner:   inner,
+		opts:    opts,
+		pollers: make(map[*poller]struct{}),
+	}
+}
+
+func (d *db) RunTx(tx kvl.Tx) error {
+	return d.inner.RunTx(tx)
+}
+
+func (d *db) RunReadTx(tx kvl.Tx) error {
+	return d.inner.RunReadTx(tx)
+}
+
+func (d *db) WatchTx(tx kvl.Tx) (kvl.WatchResult, error) {
+	wr, err := d.inner.WatchTx(tx)
+	if err != kvl.ErrWatchUnsupported {
+		return wr, err
+	}
+
+	var reads []read
+	err = d.inner.RunReadTx(func(ctx kvl.Ctx) error {
+		rec := &recordingCtx{inner: ctx}
+		err := tx(rec)
+		reads = rec.reads
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &poller{
+		db:    d,
+		reads: reads,
+		done:  make(chan struct{}),
+		stop:  make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	d.pollers[p] = struct{}{}
+	d.mu.Unlock()
+
+	go p.run()
+
+	return p, nil
+}
+
+func (d *db) RunSnapshotTx(tx kvl.Tx) error {
+	return kvl.RunSnapshotTx(d.inner, tx)
+}
+
+// Capabilities reports the capabilities of the inner DB, with Watch always
+// set. Polled watches do not report their changes.
+func (d *db) Capabilities() kvl.Capabilities {
+	caps := kvl.CapabilitiesOf(d.inner)
+	if !caps.Watch {
+		caps.Watch = true
+		caps.ChangeWatch = false
+	}
+	return caps
+}
+
+func (d *db) Ping() error {
+	return kvl.Ping(d.inner)
+}
+
+func (d *db) BulkLoad(src kvl.PairSource, opts *kvl.BulkOptions) (kvl.BulkStats, error) {
+	return kvl.BulkLoad(d.inner, src, opts)
+}
+
+// Stats reports the Stats of the inner DB, with polled watches added to its
+// count of watches if it is known.
+func (d *db) Stats() kvl.Stats {
+	stats := kvl.StatsOf(d.inner)
+	if stats.Watches >= 0 {
+		d.mu.Lock()
+		stats.Watches += len(d.pollers)
+		d.mu.Unlock()
+	}
+	return stats
+}
+
+// Shutdown fails all polled watches with kvl.ErrClosed, and shuts down the
+// inner DB.
+func (d *db) Shutdown(ctx context.Context) error {
+	d.stopPollers(kvl.ErrClosed)
+	return kvl.Shutdown(ctx, d.inner)
+}
+
+func (d *db) Close() {
+	d.stopPollers(nil)
+	d.inner.Close()
+}
+
+func (d *db) stopPollers(err error) {
+	d.mu.Lock()
+	pollers := d.pollers
+	d.pollers = make(map[*poller]struct{})
+	d.mu.Unlock()
+
+	for p := range pollers {
+		p.finish(err)
+	}
+}
+
+func (d *db) removePoller(p *poller) {
+	d.mu.Lock()
+	delete(d.pollers, p)
+	d.mu.Unlock()
+}
+
+// read is the recorded result of a Get or Range call.
+type read struct {
+	isRange bool
+	key     []byte
+	query   kvl.RangeQuery
+	pairs   []kvl.Pair // a Get stores its single result here
+	err     error
+}
+
+func (r read) redo(ctx kvl.Ctx) read {
+	again := r
+	if r.isRange {
+		again.pairs, again.err = ctx.Range(r.query)
+	} else {
+		p, err := ctx.Get(r.key)
+		again.pairs, again.err = []kvl.Pair{p}, err
+	}
+	return again
+}
+
+func (r read) equal(o read) bool {
+	if r.err != o.err || len(r.pairs) != len(o.pairs) {
+		return false
+	}
+	for i := range r.pairs {
+		if !r.pairs[i].Equal(o.pairs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func dupBytes(s []byte) []byte {
+	if s == nil {
+		return nil
+	}
+	n := make([]byte, len(s))
+	copy(n, s)
+	return n
+}
+
+type recordingCtx struct {
+	inner kvl.Ctx
+	reads []read
+}
+
+func (c *recordingCtx) TxInfo() kvl.TxInfo {
+	info, _ := kvl.TxInfoOf(c.inner)
+	return info
+}
+
+func (c *recordingCtx) TxSize() kvl.TxSize {
+	size, _ := kvl.TxSizeOf(c.inner)
+	return size
+}
+
+func (c *recordingCtx) Get(key []byte) (kvl.Pair, error) {
+	p, err := c.inner.Get(key)
+	c.reads = append(c.reads, read{
+		key:   dupBytes(key),
+		pairs: []kvl.Pair{{dupBytes(p.Key), dupBytes(p.Value)}},
+		err:   err,
+	})
+	return p, err
+}
+
+func (c *recordingCtx) Range(query kvl.RangeQuery) ([]kvl.Pair, error) {
+	ps, err := c.inner.Range(query)
+
+	query.Low = dupBytes(query.Low)
+	query.High = dupBytes(query.High)
+	saved := make([]kvl.Pair, len(ps))
+	for i, p := range ps {
+		saved[i] = kvl.Pair{dupBytes(p.Key), dupBytes(p.Value)}
+	}
+	c.reads = append(c.reads, read{isRange: true, query: query, pairs: saved, err: err})
+
+	return ps, err
+}
+
+func (c *recordingCtx) Set(p kvl.Pair) error {
+	return c.inner.Set(p)
+}
+
+func (c *recordingCtx) Delete(key []byte) error {
+	return c.inner.Delete(key)
+}
+
+type poller struct {
+	db    *db
+	reads []read
+
+	once sync.Once
+	done chan struct{}
+	stop chan struct{}
+	err  error // set before done is closed
+}
+
+func (p *poller) interval() time.Duration {
+	d := p.db.opts.Interval
+	if p.db.opts.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(p.db.opts.Jitter)))
+	}
+	return d
+}
+
+func (p *poller) run() {
+	for {
+		timer := time.NewTimer(p.interval())
+		select {
+		case <-p.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		changed := false
+		err := p.db.inner.RunReadTx(func(ctx kvl.Ctx) error {
+			changed = false
+			for _, r := range p.reads {
+				if !r.equal(r.redo(ctx)) {
+					changed = true
+					return nil
+				}
+			}
+			return nil
+		})
+
+		if err != nil || changed {
+			p.finish(err)
+			return
+		}
+	}
+}
+
+func (p *poller) finish(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+		close(p.stop)
+		p.db.removePoller(p)
+	})
+}
+
+func (p *poller) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *poller) Error() error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+func (p *poller) Close() {
+	p.finish(nil)
+}
@@ -1,30 +1,114 @@
 package kvl
 
 import (
-	"sync"
 	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
 )
 
-var registry = make(map[string]func(string) (DB, error))
+// A Backend describes a registered backend.
+type Backend struct {
+	Name        string
+	Description string
+
+	// Open opens a DB given a backend-specific DSN, as passed to kvl.Open.
+	Open func(dsn string) (DB, error)
+
+	// OpenURL, if non-nil, opens a DB given a URL whose scheme is the
+	// backend's name, as passed to kvl.OpenURL. Backends typically accept
+	// their options as query parameters.
+	OpenURL func(u *url.URL) (DB, error)
+}
+
+// UnknownBackendError is returned when opening a backend that has not been
+// registered. Backends register themselves when their package is imported.
+type UnknownBackendError string
+
+func (e UnknownBackendError) Error() string {
+	return fmt.Sprintf("kvl backend %q not registered (is its package imported?)", string(e))
+}
+
+var ErrURLUnsupported = errors.New("backend does not support opening by URL")
+
+var registry = make(map[string]Backend)
 var registryMutex sync.Mutex
 
-func Open(db, dsn string) (DB, error) {
-	registryMutex.Lock()
-	constructor, ok := registry[db]
-	if !ok {
-		registryMutex.Unlock()
-		return nil, errors.New("kvl backend not registered")
+// Register registers a backend. It panics if the name is already registered
+// or Open is nil.
+func Register(b Backend) {
+	if b.Open == nil {
+		panic("kvl: backend " + b.Name + " registered without an Open function")
 	}
-	registryMutex.Unlock()
 
-	return constructor(dsn)
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registry[b.Name]; ok {
+		panic("backend already registered")
+	}
+	registry[b.Name] = b
 }
 
+// RegisterBackend registers a backend with only an Open function.
 func RegisterBackend(db string, constructor func(string) (DB, error)) {
+	Register(Backend{Name: db, Open: constructor})
+}
+
+// Backends returns the registered backends, sorted by name.
+func Backends() []Backend {
 	registryMutex.Lock()
-	if _, ok := registry[db]; ok {
-		panic("backend already registered")
+	defer registryMutex.Unlock()
+
+	backends := make([]Backend, 0, len(registry))
+	for _, b := range registry {
+		backends = append(backends, b)
 	}
-	registry[db] = constructor
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].Name < backends[j].Name
+	})
+	return backends
+}
+
+func lookupBackend(name string) (Backend, error) {
+	registryMutex.Lock()
+	b, ok := registry[name]
 	registryMutex.Unlock()
+
+	if !ok {
+		return Backend{}, UnknownBackendError(name)
+	}
+	return b, nil
+}
+
+// Open opens a DB with the named backend and a backend-specific DSN.
+func Open(db, dsn string) (DB, error) {
+	b, err := lookupBackend(db)
+	if err != nil {
+		return nil, err
+	}
+	return b.Open(dsn)
+}
+
+// OpenURL opens a DB given a URL whose scheme names the backend, such as
+// "bolt:///var/db.bolt?timeout=1s". See the backends' documentation for the
+// URLs and options they accept.
+func OpenURL(rawurl string) (DB, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("kvl URL %q has no scheme naming its backend", rawurl)
+	}
+
+	b, err := lookupBackend(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	if b.OpenURL == nil {
+		return nil, fmt.Errorf("%v: %w", b.Name, ErrURLUnsupported)
+	}
+	return b.OpenURL(u)
 }
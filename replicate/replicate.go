@@ -0,0 +1,265 @@
+// Package replicate continuously copies the data of a changefeed.Feed into
+// another DB, for read replicas and disaster recovery.
+//
+// The target DB stores the replicated data under the same ("data") keyspace a
+// Feed uses, and the sequence number of the last applied log entry under
+// ("applied"), updated in the same transaction as the data. Use Data to read
+// the replicated data.
+package replicate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/encryptio/kvl"
+	"github.com/encryptio/kvl/changefeed"
+	"github.com/encryptio/kvl/tuple"
+)
+
+// ErrLogTrimmed is returned when log entries the target has not applied yet
+// have already been trimmed from the feed. The target must be re-seeded from
+// a copy of the source.
+var ErrLogTrimmed = errors.New("replicate: feed was trimmed past the applied position")
+
+const (
+	defaultBatchSize     = 100
+	defaultRetryInterval = time.Second
+)
+
+var (
+	dataPrefix = tuple.MustAppend(nil, "data")
+	appliedKey = tuple.MustAppend(nil, "applied")
+)
+
+// Data returns a DB for reading the replicated data stored in target.
+func Data(target kvl.DB) kvl.DB {
+	return kvl.SubDB(target, dataPrefix)
+}
+
+// Options configures a Replicator.
+type Options struct {
+	// BatchSize is the maximum number of log entries applied to the target in
+	// a single transaction. Zero means 100.
+	BatchSize int
+
+	// Consumer is the name the Replicator acknowledges applied entries under
+	// in the feed, so that the feed can be trimmed. If empty, entries are not
+	// acknowledged.
+	Consumer string
+
+	// RetryInterval is the time Run waits before retrying after an error.
+	// Zero means one second.
+	RetryInterval time.Duration
+
+	// OnError, if non-nil, is called with every error Run retries.
+	OnError func(error)
+}
+
+// A Replicator applies the log entries of a feed to a target DB.
+type Replicator struct {
+	feed   *changefeed.Feed
+	target kvl.DB
+	opts   Options
+}
+
+// New returns a Replicator copying from feed to target.
+func New(feed *changefeed.Feed, target kvl.DB, opts Options) *Replicator {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultRetryInterval
+	}
+	return &Replicator{
+		feed:   feed,
+		target: target,
+		opts:   opts,
+	}
+}
+
+// Applied returns the sequence number of the last log entry applied to the
+// target.
+func (r *Replicator) Applied() (uint64, error) {
+	var applied uint64
+	err := r.target.RunReadTx(func(ctx kvl.Ctx) error {
+		var err error
+		applied, err = getApplied(ctx)
+		return err
+	})
+	return applied, err
+}
+
+// Step applies the next batch of log entries to the target, returning the
+// number of entries applied.
+//
+// Applying entries is idempotent: the data and the applied position are
+// updated in one transaction, and entries at or before the applied position
+// are skipped, so concurrent or repeated Steps never apply an entry twice.
+func (r *Replicator) Step() (int, error) {
+	applied, err := r.Applied()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := r.feed.Read(applied, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		// with nothing left to read, the feed may still have been trimmed
+		// past entries the target never saw
+		latest, err := r.feed.Latest()
+		if err != nil {
+			return 0, err
+		}
+		if latest > applied {
+			return 0, ErrLogTrimmed
+		}
+		return 0, nil
+	}
+	if entries[0].Seq != applied+1 {
+		return 0, ErrLogTrimmed
+	}
+
+	var count int
+	err = r.target.RunTx(func(ctx kvl.Ctx) error {
+		count = 0
+
+		pos, err := getApplied(ctx)
+		if err != nil {
+			return err
+		}
+
+		data := kvl.SubCtx(ctx, dataPrefix)
+		for _, e := range entries {
+			if e.Seq <= pos {
+				continue
+			}
+
+			for _, c := range e.Changes {
+				if c.Deleted {
+					err = data.Delete(c.Key)
+					if err == kvl.ErrNotFound {
+						err = nil
+					}
+				} else {
+					err = data.Set(kvl.Pair{c.Key, c.Value})
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			pos = e.Seq
+			count++
+		}
+
+		if count == 0 {
+			return nil
+		}
+		return ctx.Set(kvl.Pair{appliedKey, tuple.MustAppend(nil, pos)})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if r.opts.Consumer != "" {
+		err = r.feed.Ack(r.opts.Consumer, entries[len(entries)-1].Seq)
+	}
+	return count, err
+}
+
+// Run applies log entries to the target until ctx is done, waiting for new
+// entries with Feed.Wait when it has caught up.
+//
+// Errors are passed to Options.OnError and retried after RetryInterval,
+// except for ErrLogTrimmed, kvl.ErrClosed from a closed feed or target, and
+// the errors of a feed that does not support watches, which are returned.
+// When ctx is done, ctx.Err() is returned.
+func (r *Replicator) Run(ctx context.Context) error {
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		n, err := r.Step()
+		if err == ErrLogTrimmed {
+			return err
+		}
+		if err == nil && n < r.opts.BatchSize {
+			var applied uint64
+			applied, err = r.Applied()
+			if err == nil {
+				err = r.feed.Wait(ctx, applied)
+				if err == kvl.ErrWatchUnsupported || (err != nil && err == ctx.Err()) {
+					return err
+				}
+			}
+		}
+
+		if err == kvl.ErrClosed {
+			return err
+		}
+		if err != nil {
+			if r.opts.OnError != nil {
+				r.opts.OnError(err)
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.opts.RetryInterval):
+			}
+		}
+	}
+}
+
+// Lag describes how far the target is behind the feed.
+type Lag struct {
+	// Entries is the number of log entries not yet applied to the target.
+	Entries uint64
+
+	// Time is the age of the oldest log entry not yet applied, or zero if the
+	// target is up to date.
+	Time time.Duration
+}
+
+// Lag returns how far the target is behind the feed.
+func (r *Replicator) Lag() (Lag, error) {
+	applied, err := r.Applied()
+	if err != nil {
+		return Lag{}, err
+	}
+
+	latest, err := r.feed.Latest()
+	if err != nil || latest <= applied {
+		return Lag{}, err
+	}
+
+	lag := Lag{Entries: latest - applied}
+
+	entries, err := r.feed.Read(applied, 1)
+	if err != nil {
+		return Lag{}, err
+	}
+	if len(entries) > 0 {
+		lag.Time = time.Since(entries[0].Time)
+	}
+
+	return lag, nil
+}
+
+func getApplied(ctx kvl.Ctx) (uint64, error) {
+	p, err := ctx.Get(appliedKey)
+	if err == kvl.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var applied uint64
+	err = tuple.UnpackInto(p.Value, &applied)
+	return applied, err
+}
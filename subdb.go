@@ -36,9 +36,50 @@ func (s subDB) RunReadTx(tx Tx) error {
 }
 
 func (s subDB) WatchTx(tx Tx) (WatchResult, error) {
-	return s.db.WatchTx(func(ctx Ctx) error {
+	wr, err := s.db.WatchTx(func(ctx Ctx) error {
 		return tx(SubCtx(ctx, s.prefix))
 	})
+	if cwr, ok := wr.(ChangeWatchResult); ok {
+		return subWatchResult{cwr, s.prefix}, err
+	}
+	return wr, err
+}
+
+func (s subDB) RunSnapshotTx(tx Tx) error {
+	return RunSnapshotTx(s.db, func(ctx Ctx) error {
+		return tx(SubCtx(ctx, s.prefix))
+	})
+}
+
+func (s subDB) Capabilities() Capabilities {
+	return CapabilitiesOf(s.db)
+}
+
+func (s subDB) Ping() error {
+	return Ping(s.db)
+}
+
+// BulkLoad loads the pairs under the prefix. The Bytes of the BulkStats
+// include the prefixes.
+func (s subDB) BulkLoad(src PairSource, opts *BulkOptions) (BulkStats, error) {
+	stats, err := BulkLoad(s.db, subSource{src, s.prefix}, opts)
+	if kerr, ok := err.(*KeyExistsError); ok {
+		err = &KeyExistsError{bytes.TrimPrefix(kerr.Key, s.prefix)}
+	}
+	return stats, err
+}
+
+type subSource struct {
+	src    PairSource
+	prefix []byte
+}
+
+func (s subSource) Next() (Pair, error) {
+	p, err := s.src.Next()
+	if err != nil {
+		return p, err
+	}
+	return Pair{prependCopy(s.prefix, p.Key), p.Value}, nil
 }
 
 // Close operations are ignored on SubDBs. You must close the inner DB yourself
@@ -103,3 +144,26 @@ func (s subCtx) Range(query RangeQuery) ([]Pair, error) {
 	}
 	return ps, err
 }
+
+func (s subCtx) TxInfo() TxInfo {
+	info, _ := TxInfoOf(s.ctx)
+	return info
+}
+
+func (s subCtx) TxSize() TxSize {
+	size, _ := TxSizeOf(s.ctx)
+	return size
+}
+
+type subWatchResult struct {
+	ChangeWatchResult
+	prefix []byte
+}
+
+func (s subWatchResult) Changes() ([][]byte, uint64, bool) {
+	keys, version, ok := s.ChangeWatchResult.Changes()
+	for i := range keys {
+		keys[i] = bytes.TrimPrefix(keys[i], s.prefix)
+	}
+	return keys, version, ok
+}
@@ -0,0 +1,139 @@
+package kvl
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultWatchLoopMinBackoff = 100 * time.Millisecond
+	defaultWatchLoopMaxBackoff = 30 * time.Second
+)
+
+// WatchLoopOptions configures WatchLoopWithOptions.
+type WatchLoopOptions struct {
+	// Coalesce is how long to wait after a change is seen before re-running
+	// the Tx, so that a burst of changes causes a single re-run. Zero re-runs
+	// immediately.
+	Coalesce time.Duration
+
+	// MinBackoff and MaxBackoff bound the exponential backoff used after
+	// errors. Zero values mean 100ms and 30s.
+	MinBackoff, MaxBackoff time.Duration
+
+	// OnError, if non-nil, is called with every error from WatchTx or from a
+	// WatchResult before backing off and trying again.
+	OnError func(error)
+}
+
+// WatchLoop calls WatchLoopWithOptions with the default options.
+func WatchLoop(ctx context.Context, db DB, tx Tx, onChange func() error) error {
+	return WatchLoopWithOptions(ctx, db, tx, onChange, WatchLoopOptions{})
+}
+
+// WatchLoopWithOptions repeatedly runs tx with db.WatchTx, calling onChange
+// after each successful run and then waiting for the keys/ranges the tx read
+// to change before running it again. Use a closure to pass the results of tx
+// to onChange.
+//
+// Errors from WatchTx (including those returned by tx) and from WatchResults
+// cause the loop to back off exponentially and try again.
+//
+// WatchLoopWithOptions returns when ctx is done (returning ctx.Err()), when
+// onChange returns a non-nil error (returning it), when db does not support
+// watches (returning ErrWatchUnsupported), or when db is closed (returning
+// ErrClosed.)
+func WatchLoopWithOptions(ctx context.Context, db DB, tx Tx, onChange func() error, opts WatchLoopOptions) error {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultWatchLoopMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultWatchLoopMaxBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+
+	var backoff time.Duration
+	failed := func(err error) error {
+		if opts.OnError != nil {
+			opts.OnError(err)
+		}
+
+		if backoff == 0 {
+			backoff = opts.MinBackoff
+		} else {
+			backoff *= 2
+			if backoff > opts.MaxBackoff {
+				backoff = opts.MaxBackoff
+			}
+		}
+
+		return sleepContext(ctx, backoff)
+	}
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		wr, err := db.WatchTx(tx)
+		if err == ErrWatchUnsupported || err == ErrClosed {
+			return err
+		}
+		if err != nil {
+			err = failed(err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = onChange()
+		if err != nil {
+			wr.Close()
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			wr.Close()
+			return ctx.Err()
+		case <-wr.Done():
+		}
+
+		err = wr.Error()
+		wr.Close()
+		if err == ErrClosed {
+			return err
+		}
+		if err != nil {
+			err = failed(err)
+		} else {
+			backoff = 0
+			err = sleepContext(ctx, opts.Coalesce)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d to pass, returning early with ctx.Err() if ctx is
+// done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}